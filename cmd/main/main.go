@@ -17,6 +17,7 @@ import (
 	"github.com/mimamch/reverse-proxy/internal/modules/proxy"
 	"github.com/mimamch/reverse-proxy/internal/utils"
 	"github.com/mimamch/reverse-proxy/pkg/database"
+	"github.com/quic-go/quic-go/http3"
 	"golang.org/x/crypto/acme/autocert"
 	"golang.org/x/sys/unix"
 )
@@ -36,17 +37,43 @@ func main() {
 	r.Use(chiMiddleware.Recoverer)
 
 	cfg := config.LoadConfig()
+
+	proxyProtocolNets, err := utils.ParseCIDRs(cfg.ProxyProtocolTrustedCIDRs)
+	if err != nil {
+		log.Fatalf("Failed to parse PROXY protocol trusted CIDRs: %v", err)
+	}
+	listen := func(addr string) (net.Listener, error) {
+		ln, err := reusePortListen(addr)
+		if err != nil || len(proxyProtocolNets) == 0 {
+			return ln, err
+		}
+		return utils.NewProxyProtocolListener(ln, proxyProtocolNets), nil
+	}
+
+	var h3Server *http3.Server
+	if cfg.HTTP3Enabled {
+		h3Server = &http3.Server{
+			Addr:    ":443",
+			Handler: r,
+		}
+		r.Use(altSvc(h3Server))
+	}
+
 	db := database.ConnectPostgres(cfg)
-	proxyService := proxy.NewService(proxy.NewRepository(db), proxy.NewProxyCache())
+	proxyRepository := proxy.NewRepository(db)
+	proxyService := proxy.NewService(proxyRepository, proxy.NewProxyCache(cfg.ProxyCacheTTL), []byte(cfg.AffinityCookieSecret))
 	proxyHandler := proxy.NewHandler(proxyService)
 
+	go proxy.NewHealthChecker(proxyRepository).Run(context.Background())
+	go proxy.NewStatePruner(proxyRepository).Run(context.Background())
+
 	r.HandleFunc("/*", proxyHandler.HandleRequest)
 
 	n := runtime.NumCPU()
 	go func() {
 		log.Printf("Starting %d HTTP server(s) on :80", n)
 		for range n {
-			ln, err := reusePortListen(":80")
+			ln, err := listen(":80")
 			if err != nil {
 				log.Fatalf("Failed to listen on :80: %v", err)
 			}
@@ -57,6 +84,8 @@ func main() {
 		}
 	}()
 
+	go proxy.NewTCPListeners(proxy.NewTCPHandler(proxyService), reusePortListen, n).Run(context.Background())
+
 	certCache := certificate.NewCertCache()
 	certRepo := certificate.NewRepository(db)
 	certService := certificate.NewService(certRepo, certCache)
@@ -74,7 +103,7 @@ func main() {
 	go func() {
 		log.Printf("Starting %d HTTPS server(s) on :443", n)
 		for range n {
-			ln, err := reusePortListen(":443")
+			ln, err := listen(":443")
 			if err != nil {
 				log.Fatalf("Failed to listen on :443: %v", err)
 			}
@@ -82,15 +111,39 @@ func main() {
 				TLSConfig: tlsConfig,
 				Handler:   r,
 			}
-			go server.ServeTLS(ln, "", "")
+			go server.ServeTLS(proxy.NewPassthroughListener(ln, proxyService), "", "")
 		}
 	}()
 
+	if h3Server != nil {
+		h3Server.TLSConfig = http3.ConfigureTLSConfig(tlsConfig)
+		go func() {
+			log.Println("Starting HTTP/3 server on udp :443")
+			if err := h3Server.ListenAndServe(); err != nil {
+				log.Fatalf("Failed to serve HTTP/3 on :443: %v", err)
+			}
+		}()
+	}
+
 	// run forever
 	<-sigs
 	log.Println("Signal received, shutting down gracefully...")
 }
 
+// altSvc advertises the HTTP/3 endpoint on responses sent over TLS on
+// TCP. Plaintext :80 responses do not advertise it, since h3 is only
+// served for the same origin over https.
+func altSvc(h3Server *http3.Server) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.TLS != nil && r.ProtoMajor < 3 {
+				_ = h3Server.SetQUICHeaders(w.Header())
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func reusePortListen(addr string) (net.Listener, error) {
 	lc := net.ListenConfig{
 		Control: func(network, address string, c syscall.RawConn) error {
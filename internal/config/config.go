@@ -2,6 +2,8 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -11,6 +13,21 @@ type Config struct {
 	DatabaseURL string
 	JWTSecret   string
 	Email       string
+
+	// how long a host's proxy config is cached before it is reloaded from
+	// the database, so edits (e.g. canary weights) apply without a restart
+	ProxyCacheTTL time.Duration
+
+	// serve HTTP/3 on UDP :443 and advertise it with Alt-Svc
+	HTTP3Enabled bool
+
+	// comma separated CIDRs (e.g. a load balancer subnet) whose connections
+	// to :80/:443 start with a PROXY protocol header; empty disables it
+	ProxyProtocolTrustedCIDRs string
+
+	// key signing session affinity cookies; when empty a random key is
+	// generated and cookies stop matching after a restart
+	AffinityCookieSecret string
 }
 
 func LoadConfig() *Config {
@@ -21,10 +38,25 @@ func LoadConfig() *Config {
 		port = os.Getenv("PORT")
 	}
 
+	// nothing invalidates cached configs on write, so changes made in the
+	// database take effect after at most this long
+	proxyCacheTTL := 30 * time.Second
+	if ttl, err := time.ParseDuration(os.Getenv("PROXY_CACHE_TTL")); err == nil && ttl > 0 {
+		proxyCacheTTL = ttl
+	}
+
+	http3Enabled, _ := strconv.ParseBool(os.Getenv("HTTP3_ENABLED"))
+
 	return &Config{
 		Port:        port,
 		DatabaseURL: os.Getenv("DATABASE_URL"),
 		JWTSecret:   os.Getenv("JWT_SECRET"),
 		Email:       os.Getenv("EMAIL"),
+
+		ProxyCacheTTL: proxyCacheTTL,
+		HTTP3Enabled:  http3Enabled,
+
+		ProxyProtocolTrustedCIDRs: os.Getenv("PROXY_PROTOCOL_TRUSTED_CIDRS"),
+		AffinityCookieSecret:      os.Getenv("AFFINITY_COOKIE_SECRET"),
 	}
 }
@@ -36,7 +36,9 @@ func NewTLSConfig(
 
 		// 3️⃣ let's encrypt
 		log.Println("Obtaining certificate from Let's Encrypt for domain:", domain)
-		log.Printf("TLS handshake SNI=%q from %s", hello.ServerName, hello.Conn.RemoteAddr())
+		if hello.Conn != nil { // nil for QUIC (HTTP/3) handshakes
+			log.Printf("TLS handshake SNI=%q from %s", hello.ServerName, hello.Conn.RemoteAddr())
+		}
 		cert, err := acmeManager.GetCertificate(hello)
 		if err != nil {
 			return nil, err
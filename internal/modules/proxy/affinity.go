@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Affinity pins a client to the backend that served it first, through a
+// signed cookie naming that backend.
+type Affinity struct {
+	Cookie   string
+	TTL      time.Duration // zero makes it a session cookie
+	Path     string
+	Domain   string
+	Secure   bool // set regardless of the request scheme, it is always set over TLS
+	HTTPOnly bool
+	SameSite http.SameSite
+}
+
+func newAffinity(proxy ProxyModel) *Affinity {
+	if proxy.AffinityCookie == "" {
+		return nil
+	}
+
+	affinity := &Affinity{
+		Cookie:   proxy.AffinityCookie,
+		TTL:      time.Duration(proxy.AffinityCookieTTL) * time.Second,
+		Path:     proxy.AffinityCookiePath,
+		Domain:   proxy.AffinityCookieDomain,
+		Secure:   proxy.AffinityCookieSecure,
+		HTTPOnly: proxy.AffinityCookieHTTPOnly,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if affinity.Path == "" {
+		affinity.Path = "/"
+	}
+	switch strings.ToLower(proxy.AffinityCookieSameSite) {
+	case "strict":
+		affinity.SameSite = http.SameSiteStrictMode
+	case "none":
+		affinity.SameSite = http.SameSiteNoneMode
+		affinity.Secure = true // browsers drop SameSite=None without Secure
+	}
+	return affinity
+}
+
+func (a *Affinity) cookie(r *http.Request, value string) *http.Cookie {
+	return &http.Cookie{
+		Name:     a.Cookie,
+		Value:    value,
+		Path:     a.Path,
+		Domain:   a.Domain,
+		MaxAge:   int(a.TTL.Seconds()),
+		Secure:   a.Secure || r.TLS != nil,
+		HttpOnly: a.HTTPOnly,
+		SameSite: a.SameSite,
+	}
+}
+
+// affinityCookie issues the session affinity cookie naming the backend
+// that served a request, which may differ from the one first picked when
+// the request was retried.
+type affinityCookie struct {
+	affinity *Affinity
+	signer   cookieSigner
+	pinned   string // backend ID the request's valid cookie names, if any
+}
+
+// forBackend returns the cookie pinning the client to backend, nil when c
+// is nil or the client is pinned to backend already.
+func (c *affinityCookie) forBackend(r *http.Request, backend Backend) *http.Cookie {
+	if c == nil || backend.ID == c.pinned {
+		return nil
+	}
+	return c.affinity.cookie(r, c.signer.sign(backend.ID))
+}
+
+// cookieSigner signs cookie values with HMAC-SHA256 so clients cannot pick
+// a backend of their choosing.
+type cookieSigner struct {
+	key []byte
+}
+
+// newCookieSigner uses secret, or a random key when it is empty, in which
+// case signed cookies do not survive a restart.
+func newCookieSigner(secret []byte) cookieSigner {
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		rand.Read(secret)
+	}
+	return cookieSigner{key: secret}
+}
+
+func (s cookieSigner) sign(value string) string {
+	return value + "." + base64.RawURLEncoding.EncodeToString(s.mac(value))
+}
+
+func (s cookieSigner) verify(signed string) (string, bool) {
+	i := strings.LastIndexByte(signed, '.')
+	if i < 0 {
+		return "", false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(signed[i+1:])
+	if err != nil || !hmac.Equal(sig, s.mac(signed[:i])) {
+		return "", false
+	}
+	return signed[:i], true
+}
+
+func (s cookieSigner) mac(value string) []byte {
+	h := hmac.New(sha256.New, s.key)
+	h.Write([]byte(value))
+	return h.Sum(nil)
+}
@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCookieSigner(t *testing.T) {
+	signer := newCookieSigner([]byte("secret"))
+
+	value, ok := signer.verify(signer.sign("backend-1"))
+	assert.True(t, ok)
+	assert.Equal(t, "backend-1", value)
+
+	_, ok = signer.verify("backend-2" + signer.sign("backend-1")[len("backend-1"):])
+	assert.False(t, ok)
+
+	_, ok = newCookieSigner([]byte("other")).verify(signer.sign("backend-1"))
+	assert.False(t, ok)
+}
+
+func TestSessionAffinity(t *testing.T) {
+	s := &service{signer: newCookieSigner([]byte("secret"))}
+	proxy := ProxyModel{AffinityCookie: "rp_backend", AffinityCookieTTL: 3600, AffinityCookieHTTPOnly: true}
+	pool := newPool([]Backend{{ID: "a"}, {ID: "b"}, {ID: "c"}}, nil, proxy)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	backend, _, _, affinity, err := s.nextBackend(pool, r)
+	assert.NoError(t, err)
+	cookie := affinity.forBackend(r, backend)
+	assert.NotNil(t, cookie)
+	assert.Equal(t, "rp_backend", cookie.Name)
+	assert.Equal(t, 3600, cookie.MaxAge)
+	assert.True(t, cookie.HttpOnly)
+
+	for range 10 {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.AddCookie(cookie)
+		next, _, _, nextAffinity, err := s.nextBackend(pool, r)
+		assert.NoError(t, err)
+		assert.Nil(t, nextAffinity.forBackend(r, next))
+		assert.Equal(t, backend.ID, next.ID)
+	}
+
+	// the pinned backend was disabled: balance again and re-pin
+	var remaining []Backend
+	for _, b := range pool.Backends {
+		if b.ID != backend.ID {
+			remaining = append(remaining, b)
+		}
+	}
+	pool = newPool(remaining, nil, proxy)
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(cookie)
+	next, _, _, nextAffinity, err := s.nextBackend(pool, r)
+	assert.NoError(t, err)
+	assert.NotEqual(t, backend.ID, next.ID)
+	assert.NotNil(t, nextAffinity.forBackend(r, next))
+
+	// forged cookies are ignored
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: "rp_backend", Value: remaining[0].ID + ".forged"})
+	next, _, _, nextAffinity, err = s.nextBackend(pool, r)
+	assert.NoError(t, err)
+	assert.NotNil(t, nextAffinity.forBackend(r, next))
+}
+
+func TestSessionAffinityPinsRetriedBackend(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	live := backendFor(t, upstream)
+	live.ID = "affinity-live"
+	signer := newCookieSigner([]byte("secret"))
+	target := retryTarget([]Backend{deadBackend(t, "affinity-dead"), live}, ProxyModel{ID: "affinity-proxy", RetryAttempts: 1, AffinityCookie: "rp_backend"})
+	target.affinity = &affinityCookie{affinity: target.Pool.Affinity, signer: signer}
+
+	w := httptest.NewRecorder()
+	NewHandler(&stubService{target: target}).HandleRequest(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	cookies := w.Result().Cookies()
+	assert.Len(t, cookies, 1)
+	id, ok := signer.verify(cookies[0].Value)
+	assert.True(t, ok)
+	assert.Equal(t, live.ID, id)
+}
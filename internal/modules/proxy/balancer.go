@@ -0,0 +1,170 @@
+package proxy
+
+import (
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	BalancerRoundRobin = "round_robin" // smooth weighted round robin (default)
+	BalancerRandom     = "random"      // weighted random
+	BalancerLeastConn  = "least_conn"  // fewest in-flight requests per weight
+	BalancerP2C        = "p2c"         // power of two random choices by in-flight requests
+	BalancerHash       = "hash"        // consistent hash of HashKey
+	BalancerEWMA       = "ewma"        // lowest moving average latency and error rate
+)
+
+// Balancer picks one of backends, which is never empty, for a request. r
+// is nil for layer-4 connections.
+type Balancer interface {
+	Next(r *http.Request, backends []Backend) Backend
+}
+
+// newBalancer returns a fresh balancer for the proxy's algorithm over the
+// configured backends of a pool or group. Every pool and group gets its
+// own, as balancers may keep per-list state.
+func newBalancer(proxy ProxyModel, backends []Backend) Balancer {
+	switch proxy.LBAlgorithm {
+	case BalancerRandom:
+		return randomBalancer{}
+	case BalancerLeastConn:
+		return &leastConnBalancer{}
+	case BalancerP2C:
+		return p2cBalancer{}
+	case BalancerHash:
+		return newRingHashBalancer(proxy, backends)
+	case BalancerEWMA:
+		return &ewmaBalancer{}
+	case "", BalancerRoundRobin:
+	default:
+		log.Printf("Unknown load balancing algorithm %q, using %s", proxy.LBAlgorithm, BalancerRoundRobin)
+	}
+	return &smoothRoundRobin{}
+}
+
+// smoothRoundRobin is nginx's smooth weighted round robin: every pick adds
+// each backend's weight to its score, takes the highest score and lowers it
+// by the total. Weights 5,1,1 give a a b a c a a instead of five a's in a
+// row.
+type smoothRoundRobin struct {
+	mu     sync.Mutex
+	scores map[string]int // by backend ID
+}
+
+func (s *smoothRoundRobin) Next(_ *http.Request, backends []Backend) Backend {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.scores == nil {
+		s.scores = make(map[string]int, len(backends))
+	}
+
+	best, total := 0, 0
+	for i, backend := range backends {
+		weight := backend.effectiveWeight()
+		s.scores[backend.ID] += weight
+		total += weight
+		if s.scores[backend.ID] > s.scores[backends[best].ID] {
+			best = i
+		}
+	}
+	s.scores[backends[best].ID] -= total
+
+	// backends left out, e.g. unhealthy ones, start over when they return
+	if len(s.scores) > len(backends) {
+		present := make(map[string]bool, len(backends))
+		for _, backend := range backends {
+			present[backend.ID] = true
+		}
+		for id := range s.scores {
+			if !present[id] {
+				delete(s.scores, id)
+			}
+		}
+	}
+
+	return backends[best]
+}
+
+type randomBalancer struct{}
+
+func (randomBalancer) Next(_ *http.Request, backends []Backend) Backend {
+	total := 0
+	for _, backend := range backends {
+		total += backend.effectiveWeight()
+	}
+
+	n := rand.IntN(total)
+	for _, backend := range backends {
+		if n < backend.effectiveWeight() {
+			return backend
+		}
+		n -= backend.effectiveWeight()
+	}
+	return backends[len(backends)-1]
+}
+
+type leastConnBalancer struct {
+	nextIdx atomic.Uint64
+}
+
+func (b *leastConnBalancer) Next(_ *http.Request, backends []Backend) Backend {
+	// start the scan at a rotating offset so ties are spread evenly
+	offset := int(b.nextIdx.Add(1) % uint64(len(backends)))
+
+	best := backends[offset]
+	for i := 1; i < len(backends); i++ {
+		backend := backends[(offset+i)%len(backends)]
+		if lessLoaded(backend, best) {
+			best = backend
+		}
+	}
+	return best
+}
+
+type p2cBalancer struct{}
+
+func (p2cBalancer) Next(_ *http.Request, backends []Backend) Backend {
+	if len(backends) == 1 {
+		return backends[0]
+	}
+
+	i := rand.IntN(len(backends))
+	j := rand.IntN(len(backends) - 1)
+	if j >= i {
+		j++
+	}
+
+	if lessLoaded(backends[j], backends[i]) {
+		return backends[j]
+	}
+	return backends[i]
+}
+
+// lessLoaded compares in-flight requests relative to weight, so a backend
+// with weight 2 is as loaded at 4 requests as one with weight 1 at 2.
+func lessLoaded(a, b Backend) bool {
+	return stateFor(a).inFlight.Load()*int64(b.effectiveWeight()) <
+		stateFor(b).inFlight.Load()*int64(a.effectiveWeight())
+}
+
+// effectiveWeight is at least 1. The database enforces that for stored
+// backends; a zero weight only comes from backends built in code, which
+// share traffic evenly.
+func (b Backend) effectiveWeight() int {
+	if b.Weight < 1 {
+		return 1
+	}
+	return b.Weight
+}
+
+// trackInFlight marks a request to backend as started. The returned func
+// marks it done.
+func trackInFlight(backend Backend) func() {
+	counter := &stateFor(backend).inFlight
+	counter.Add(1)
+	return func() { counter.Add(-1) }
+}
@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSmoothRoundRobinSurvivesRemovedBackend(t *testing.T) {
+	backends := []Backend{{ID: "srr-a", Weight: 3}, {ID: "srr-b", Weight: 2}, {ID: "srr-c", Weight: 1}}
+	balancer := newBalancer(ProxyModel{LBAlgorithm: BalancerRoundRobin}, backends).(*smoothRoundRobin)
+
+	for range 4 {
+		balancer.Next(nil, backends)
+	}
+
+	// drop the middle backend half way through a cycle
+	backends = []Backend{backends[0], backends[2]}
+	counts := map[string]int{}
+	for range 400 {
+		counts[balancer.Next(nil, backends).ID]++
+	}
+	assert.InDelta(t, 300, counts["srr-a"], 1)
+	assert.InDelta(t, 100, counts["srr-c"], 1)
+	assert.Len(t, balancer.scores, 2)
+}
+
+func TestRandomBalancerHonoursWeights(t *testing.T) {
+	backends := []Backend{{ID: "big", Weight: 3}, {ID: "small", Weight: 1}}
+	balancer := newBalancer(ProxyModel{LBAlgorithm: BalancerRandom}, backends)
+
+	counts := map[string]int{}
+	for range 10000 {
+		counts[balancer.Next(nil, backends).ID]++
+	}
+	assert.InDelta(t, 7500, counts["big"], 300)
+	assert.InDelta(t, 2500, counts["small"], 300)
+}
+
+func TestLeastConnBalancerPicksFewestInFlight(t *testing.T) {
+	backends := []Backend{{ID: "lc-busy"}, {ID: "lc-idle"}, {ID: "lc-heavy", Weight: 4}}
+	balancer := newBalancer(ProxyModel{LBAlgorithm: BalancerLeastConn}, backends)
+
+	var dones []func()
+	defer func() {
+		for _, done := range dones {
+			done()
+		}
+	}()
+	for range 3 {
+		dones = append(dones, trackInFlight(backends[0]))
+	}
+	dones = append(dones, trackInFlight(backends[1]))
+	// 4 requests on weight 4 count like 1 request on weight 1
+	for range 4 {
+		dones = append(dones, trackInFlight(backends[2]))
+	}
+
+	counts := map[string]int{}
+	for range 10 {
+		counts[balancer.Next(nil, backends).ID]++
+	}
+	assert.Zero(t, counts["lc-busy"])
+	assert.Equal(t, 10, counts["lc-idle"]+counts["lc-heavy"])
+	assert.NotZero(t, counts["lc-idle"])
+	assert.NotZero(t, counts["lc-heavy"])
+}
+
+func TestP2CBalancerAvoidsLoadedBackend(t *testing.T) {
+	backends := []Backend{{ID: "p2c-a"}, {ID: "p2c-b"}}
+	balancer := newBalancer(ProxyModel{LBAlgorithm: BalancerP2C}, backends)
+
+	done := trackInFlight(backends[0])
+	defer done()
+
+	for range 20 {
+		assert.Equal(t, "p2c-b", balancer.Next(nil, backends).ID)
+	}
+}
@@ -0,0 +1,268 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	breakerClosed = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// CircuitBreaker stops sending requests to a backend whose error rate or
+// average latency over the rolling window crosses a threshold. After
+// OpenDuration it lets HalfOpenRequests probes through; if they all
+// succeed the circuit closes, a single failure opens it again.
+type CircuitBreaker struct {
+	ErrorPercent     int           // 0 disables the error rate threshold
+	Latency          time.Duration // average latency threshold, 0 disables it
+	Window           time.Duration
+	MinRequests      int // requests in the window before the circuit may trip
+	OpenDuration     time.Duration
+	HalfOpenRequests int
+	Status           int           // sent when every backend is open
+	RetryAfter       time.Duration // zero sends the time until the next probe
+}
+
+func newCircuitBreaker(proxy ProxyModel) *CircuitBreaker {
+	if proxy.BreakerErrorPercent <= 0 && proxy.BreakerLatencyMs <= 0 {
+		return nil
+	}
+
+	breaker := &CircuitBreaker{
+		ErrorPercent:     max(proxy.BreakerErrorPercent, 0),
+		Latency:          time.Duration(max(proxy.BreakerLatencyMs, 0)) * time.Millisecond,
+		Window:           time.Duration(proxy.BreakerWindow) * time.Second,
+		MinRequests:      max(proxy.BreakerMinRequests, 1),
+		OpenDuration:     time.Duration(proxy.BreakerOpenDuration) * time.Second,
+		HalfOpenRequests: max(proxy.BreakerHalfOpenRequests, 1),
+		Status:           proxy.BreakerStatus,
+		RetryAfter:       time.Duration(proxy.BreakerRetryAfter) * time.Second,
+	}
+	if breaker.Window < time.Second {
+		breaker.Window = 10 * time.Second
+	}
+	if breaker.OpenDuration <= 0 {
+		breaker.OpenDuration = 30 * time.Second
+	}
+	if breaker.Status < 400 || breaker.Status > 599 {
+		breaker.Status = 503
+	}
+	return breaker
+}
+
+// CircuitOpenError is returned when every backend of a pool has an open
+// circuit.
+type CircuitOpenError struct {
+	Status     int
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit open on every backend, retry after %s", e.RetryAfter)
+}
+
+type breakerBucket struct {
+	second   int64
+	requests int
+	failures int
+	latency  time.Duration
+}
+
+type breakerState struct {
+	mu         sync.Mutex
+	state      int
+	generation int // bumped on every state change
+	openedAt   time.Time
+	admitted   int // half-open probes let through
+	succeeded  int // half-open probes that succeeded
+	buckets    []breakerBucket
+}
+
+func (s *breakerState) set(state int) {
+	s.state, s.admitted, s.succeeded = state, 0, 0
+	s.generation++
+}
+
+// allows reports whether backend may be picked: its circuit is closed, or
+// it is due a probe. It does not change the circuit, admit does that for
+// the backend actually picked. It is true for every backend when c is nil.
+func (c *CircuitBreaker) allows(backend Backend) bool {
+	if c == nil {
+		return true
+	}
+
+	state := &stateFor(backend).breaker
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	switch state.state {
+	case breakerOpen:
+		return time.Since(state.openedAt) >= c.OpenDuration
+	case breakerHalfOpen:
+		return state.admitted < c.HalfOpenRequests
+	}
+	return true
+}
+
+// breakerTicket is a request's pass through a backend's circuit. Its
+// result only counts while the circuit is still in the state it was
+// admitted in; a half-open ticket holds a probe slot until then.
+type breakerTicket struct {
+	breaker    *CircuitBreaker
+	backend    Backend
+	state      *breakerState
+	generation int
+	probe      bool
+	done       bool
+}
+
+// admit lets a request through the circuit of the picked backend, moving
+// an open circuit to half-open once OpenDuration is over and taking a
+// probe slot when half-open. ok is false when no slot is left. The ticket
+// is nil when c is nil.
+func (c *CircuitBreaker) admit(backend Backend) (ticket *breakerTicket, ok bool) {
+	if c == nil {
+		return nil, true
+	}
+
+	state := &stateFor(backend).breaker
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if state.state == breakerOpen {
+		if time.Since(state.openedAt) < c.OpenDuration {
+			return nil, false
+		}
+		state.set(breakerHalfOpen)
+	}
+
+	probe := state.state == breakerHalfOpen
+	if probe {
+		if state.admitted >= c.HalfOpenRequests {
+			return nil, false
+		}
+		state.admitted++
+	}
+
+	return &breakerTicket{breaker: c, backend: backend, state: state, generation: state.generation, probe: probe}, true
+}
+
+// record counts the outcome of the request. Outcomes of requests admitted
+// before the circuit last changed state are ignored.
+func (t *breakerTicket) record(latency time.Duration, failed bool) {
+	if t == nil {
+		return
+	}
+
+	state, c := t.state, t.breaker
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if t.done || t.generation != state.generation {
+		t.done = true
+		return
+	}
+	t.done = true
+
+	now := time.Now()
+	if state.state == breakerHalfOpen {
+		if failed {
+			c.open(state, t.backend, now, "a half-open probe failed")
+			return
+		}
+		state.succeeded++
+		if state.succeeded >= c.HalfOpenRequests {
+			state.set(breakerClosed)
+			state.buckets = nil
+			log.Printf("Circuit of backend %s (%s) closed", t.backend.ID, backendAddr(t.backend))
+		}
+		return
+	}
+
+	size := int(c.Window / time.Second)
+	if len(state.buckets) != size {
+		state.buckets = make([]breakerBucket, size)
+	}
+
+	second := now.Unix()
+	bucket := &state.buckets[second%int64(size)]
+	if bucket.second != second {
+		*bucket = breakerBucket{second: second}
+	}
+	bucket.requests++
+	bucket.latency += latency
+	if failed {
+		bucket.failures++
+	}
+
+	var requests, failures int
+	var total time.Duration
+	for _, b := range state.buckets {
+		if second-b.second < int64(size) {
+			requests += b.requests
+			failures += b.failures
+			total += b.latency
+		}
+	}
+	if requests < c.MinRequests {
+		return
+	}
+
+	switch {
+	case c.ErrorPercent > 0 && failures*100 >= c.ErrorPercent*requests:
+		c.open(state, t.backend, now, fmt.Sprintf("%d%% of %d requests failed", failures*100/requests, requests))
+	case c.Latency > 0 && total/time.Duration(requests) >= c.Latency:
+		c.open(state, t.backend, now, fmt.Sprintf("average latency %s over %d requests", total/time.Duration(requests), requests))
+	}
+}
+
+// release gives back the probe slot of a ticket that ended without a
+// verdict, e.g. because the client went away or it was never used. It does
+// nothing once the outcome was recorded.
+func (t *breakerTicket) release() {
+	if t == nil {
+		return
+	}
+
+	state := t.state
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if !t.done && t.probe && t.generation == state.generation {
+		state.admitted--
+	}
+	t.done = true
+}
+
+func (c *CircuitBreaker) open(state *breakerState, backend Backend, now time.Time, reason string) {
+	state.set(breakerOpen)
+	state.openedAt = now
+	log.Printf("Circuit of backend %s (%s) opened for %s: %s", backend.ID, backendAddr(backend), c.OpenDuration, reason)
+}
+
+// openError describes backends that are all open, with the time until
+// the first of them lets probes through unless RetryAfter is configured.
+func (c *CircuitBreaker) openError(backends []Backend) *CircuitOpenError {
+	retryAfter := c.RetryAfter
+	if retryAfter <= 0 {
+		retryAfter = c.OpenDuration
+		for _, backend := range backends {
+			state := &stateFor(backend).breaker
+			state.mu.Lock()
+			if state.state == breakerOpen {
+				retryAfter = min(retryAfter, c.OpenDuration-time.Since(state.openedAt))
+			}
+			state.mu.Unlock()
+		}
+	}
+
+	return &CircuitOpenError{
+		Status:     c.Status,
+		RetryAfter: max(retryAfter, time.Second),
+	}
+}
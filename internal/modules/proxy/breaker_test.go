@@ -0,0 +1,145 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreakerStates(t *testing.T) {
+	breaker := &CircuitBreaker{
+		ErrorPercent:     50,
+		Window:           10 * time.Second,
+		MinRequests:      4,
+		OpenDuration:     time.Minute,
+		HalfOpenRequests: 2,
+		Status:           http.StatusServiceUnavailable,
+	}
+	backend := Backend{ID: "breaker-states"}
+	defer backendStates.Delete(backend.ID)
+
+	for _, failed := range []bool{false, true, false} {
+		recordOn(t, breaker, backend, time.Millisecond, failed)
+	}
+	assert.True(t, breaker.allows(backend))
+
+	recordOn(t, breaker, backend, time.Millisecond, true) // 2 of 4 failed
+	assert.False(t, breaker.allows(backend))
+
+	// once the open duration is over, a limited number of probes pass
+	state := &stateFor(backend).breaker
+	state.openedAt = time.Now().Add(-time.Minute)
+	assert.True(t, breaker.allows(backend))
+	assert.Equal(t, breakerOpen, state.state)
+
+	first, ok := breaker.admit(backend)
+	assert.True(t, ok)
+	second, ok := breaker.admit(backend)
+	assert.True(t, ok)
+	_, ok = breaker.admit(backend)
+	assert.False(t, ok)
+	assert.False(t, breaker.allows(backend))
+
+	first.record(time.Millisecond, false)
+	assert.Equal(t, breakerHalfOpen, state.state)
+	second.record(time.Millisecond, false)
+	assert.Equal(t, breakerClosed, state.state)
+
+	// a failed probe opens the circuit again
+	state.set(breakerOpen)
+	state.openedAt = time.Now().Add(-time.Minute)
+	recordOn(t, breaker, backend, time.Millisecond, true)
+	assert.False(t, breaker.allows(backend))
+}
+
+func TestCircuitBreakerHalfOpenTickets(t *testing.T) {
+	breaker := &CircuitBreaker{ErrorPercent: 50, Window: 10 * time.Second, MinRequests: 1, OpenDuration: time.Minute, HalfOpenRequests: 1}
+	backend := Backend{ID: "breaker-tickets"}
+	defer backendStates.Delete(backend.ID)
+
+	// admitted while closed, finishing after the circuit went half-open
+	early, ok := breaker.admit(backend)
+	assert.True(t, ok)
+	recordOn(t, breaker, backend, time.Millisecond, true)
+	state := &stateFor(backend).breaker
+	state.openedAt = time.Now().Add(-time.Minute)
+
+	// an unused probe slot goes back
+	probe, ok := breaker.admit(backend)
+	assert.True(t, ok)
+	probe.release()
+	probe, ok = breaker.admit(backend)
+	assert.True(t, ok)
+
+	early.record(time.Millisecond, false)
+	assert.Equal(t, breakerHalfOpen, state.state)
+	assert.Equal(t, 0, state.succeeded)
+
+	probe.record(time.Millisecond, false)
+	probe.release()
+	assert.Equal(t, breakerClosed, state.state)
+	assert.Equal(t, 0, state.admitted)
+}
+
+func TestPoolOnlyMovesPickedCircuit(t *testing.T) {
+	backends := []Backend{{ID: "breaker-pick-a"}, {ID: "breaker-pick-b"}}
+	pool := newPool(backends, nil, ProxyModel{BreakerErrorPercent: 50, BreakerMinRequests: 1, BreakerOpenDuration: 60})
+	for _, backend := range backends {
+		defer backendStates.Delete(backend.ID)
+		recordOn(t, pool.Breaker, backend, time.Millisecond, true)
+		stateFor(backend).breaker.openedAt = time.Now().Add(-time.Minute)
+	}
+
+	backend, ticket, _, err := pool.Next(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NoError(t, err)
+	assert.NotNil(t, ticket)
+
+	for _, other := range backends {
+		want := breakerOpen
+		if other.ID == backend.ID {
+			want = breakerHalfOpen
+		}
+		assert.Equal(t, want, stateFor(other).breaker.state, other.ID)
+	}
+}
+
+func TestCircuitBreakerLatency(t *testing.T) {
+	breaker := &CircuitBreaker{Latency: 100 * time.Millisecond, Window: 10 * time.Second, MinRequests: 3, OpenDuration: time.Minute}
+	backend := Backend{ID: "breaker-latency"}
+	defer backendStates.Delete(backend.ID)
+
+	recordOn(t, breaker, backend, 50*time.Millisecond, false)
+	recordOn(t, breaker, backend, 80*time.Millisecond, false)
+	assert.True(t, breaker.allows(backend))
+	recordOn(t, breaker, backend, 300*time.Millisecond, false)
+	assert.False(t, breaker.allows(backend))
+}
+
+func TestHandlerAllCircuitsOpen(t *testing.T) {
+	backends := []Backend{{ID: "breaker-a"}, {ID: "breaker-b"}}
+	pool := newPool(backends, nil, ProxyModel{BreakerErrorPercent: 50, BreakerMinRequests: 1, BreakerStatus: 529, BreakerRetryAfter: 15})
+	for _, backend := range backends {
+		defer backendStates.Delete(backend.ID)
+		recordOn(t, pool.Breaker, backend, time.Millisecond, true)
+	}
+
+	_, _, _, err := pool.Next(nil)
+	var openErr *CircuitOpenError
+	assert.ErrorAs(t, err, &openErr)
+
+	handler := NewHandler(NewService(&stubRepository{pool: pool}, NewProxyCache(time.Minute), nil))
+	w := httptest.NewRecorder()
+	handler.HandleRequest(w, httptest.NewRequest(http.MethodGet, "http://app.example.com/", nil))
+	assert.Equal(t, 529, w.Code)
+	assert.Equal(t, "15", w.Header().Get("Retry-After"))
+}
+
+// recordOn admits a request to backend and records its outcome.
+func recordOn(t *testing.T, breaker *CircuitBreaker, backend Backend, latency time.Duration, failed bool) {
+	ticket, ok := breaker.admit(backend)
+	assert.True(t, ok)
+	ticket.record(latency, failed)
+}
@@ -1,69 +1,59 @@
 package proxy
 
 import (
-	"sync"
-	"sync/atomic"
 	"time"
 )
 
 type cachedConfig struct {
 	Route      *TargetConfig
-	ExpiryTime int64 // unix nano
-	NextIdx    uint64
-	LastAccess int64 // unix nano (atomic)
+	HostID     string // in hostCache, empty for an unknown host
+	ExpiryTime int64  // unix nano
 }
 
-const MaxCacheSize = 1000
+// MaxCacheSize bounds each of the caches. A wildcard host may serve many
+// concrete hosts, so the least recently used entries go when it is full.
+const MaxCacheSize = 10000
 
 type ProxyCache struct {
-	routeCache map[string]*cachedConfig
-	mutex      sync.RWMutex
+	routeCache *lruCache[string, *cachedConfig] // configs per stored host or TCP proxy
+	hostCache  *lruCache[string, *cachedConfig] // concrete host -> stored host ID
 	cacheTTL   time.Duration
-	maxSize    int
 }
 
-func NewProxyCache() *ProxyCache {
+func NewProxyCache(ttl time.Duration) *ProxyCache {
 	return &ProxyCache{
-		routeCache: make(map[string]*cachedConfig),
-		cacheTTL:   1 * time.Hour,
-		maxSize:    MaxCacheSize,
+		routeCache: newLRUCache[string, *cachedConfig](MaxCacheSize, nil),
+		hostCache:  newLRUCache[string, *cachedConfig](MaxCacheSize, nil),
+		cacheTTL:   ttl,
 	}
 }
 
 // ========================
-// GET (NO WRITE LOCK)
+// GET
 // ========================
-func (c *ProxyCache) Get(domain string) (*cachedConfig, bool) {
-	c.mutex.RLock()
-	config, found := c.routeCache[domain]
-	c.mutex.RUnlock()
+func (c *ProxyCache) Get(key string) (*cachedConfig, bool) {
+	return get(c.routeCache, key)
+}
 
+// GetHostID returns the stored host ID cached for a concrete host.
+func (c *ProxyCache) GetHostID(domain string) (string, bool) {
+	config, found := get(c.hostCache, domain)
 	if !found {
-		return nil, false
+		return "", false
 	}
+	return config.HostID, true
+}
 
-	now := time.Now().UnixNano()
-
-	// cek expiry
-	if atomic.LoadInt64(&config.ExpiryTime) < now {
-		c.mutex.Lock()
-		// double check
-		if cfg, ok := c.routeCache[domain]; ok {
-			if atomic.LoadInt64(&cfg.ExpiryTime) < now {
-				delete(c.routeCache, domain)
-			}
-		}
-		c.mutex.Unlock()
+func get(cache *lruCache[string, *cachedConfig], key string) (*cachedConfig, bool) {
+	config, found := cache.get(key)
+	if !found {
 		return nil, false
 	}
 
-	// update LastAccess TANPA LOCK
-	atomic.StoreInt64(&config.LastAccess, now)
-
-	if config.NextIdx == ^uint64(0) { // overflow check
-		atomic.StoreUint64(&config.NextIdx, 0)
-	} else {
-		atomic.AddUint64(&config.NextIdx, 1)
+	// cek expiry
+	if config.ExpiryTime < time.Now().UnixNano() {
+		cache.remove(key)
+		return nil, false
 	}
 
 	return config, true
@@ -72,64 +62,17 @@ func (c *ProxyCache) Get(domain string) (*cachedConfig, bool) {
 // ========================
 // SET
 // ========================
-func (c *ProxyCache) Set(domain string, config *TargetConfig) {
-	now := time.Now().UnixNano()
-
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
-
-	// evict jika penuh
-	if len(c.routeCache) >= c.maxSize {
-		c.evictLRU()
-	}
-
-	c.routeCache[domain] = &cachedConfig{
-		Route:      config,
-		ExpiryTime: now + c.cacheTTL.Nanoseconds(),
-		NextIdx:    0,
-		LastAccess: now,
-	}
-}
-
-// ========================
-// LRU EVICTION (BEST-EFFORT)
-// ========================
-func (c *ProxyCache) evictLRU() {
-	var oldestKey string
-	var oldestTime int64 = time.Now().UnixNano()
-
-	for key, cfg := range c.routeCache {
-		lastAccess := atomic.LoadInt64(&cfg.LastAccess)
-		if lastAccess < oldestTime {
-			oldestTime = lastAccess
-			oldestKey = key
-		}
-	}
-
-	if oldestKey != "" {
-		delete(c.routeCache, oldestKey)
-	}
+func (c *ProxyCache) Set(key string, config *TargetConfig) {
+	c.set(c.routeCache, key, &cachedConfig{Route: config})
 }
 
-// ========================
-// OPTIONAL: CLEANUP EXPIRED
-// ========================
-func (c *ProxyCache) CleanupExpired() {
-	now := time.Now().UnixNano()
-
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
-
-	for key, cfg := range c.routeCache {
-		if atomic.LoadInt64(&cfg.ExpiryTime) < now {
-			delete(c.routeCache, key)
-		}
-	}
+// SetHostID caches the stored host ID serving a concrete host, empty when
+// no host serves it.
+func (c *ProxyCache) SetHostID(domain string, hostID string) {
+	c.set(c.hostCache, domain, &cachedConfig{HostID: hostID})
 }
 
-func (c *ProxyCache) Invalidate(domain string) {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
-
-	delete(c.routeCache, domain)
+func (c *ProxyCache) set(cache *lruCache[string, *cachedConfig], key string, config *cachedConfig) {
+	config.ExpiryTime = time.Now().UnixNano() + c.cacheTTL.Nanoseconds()
+	cache.add(key, config)
 }
@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxyCacheExpiry(t *testing.T) {
+	cache := NewProxyCache(time.Minute)
+	cache.Set("host:1", &TargetConfig{})
+	cache.SetHostID("a.example.com", "1")
+
+	config, found := cache.Get("host:1")
+	assert.True(t, found)
+	assert.NotNil(t, config.Route)
+	hostID, found := cache.GetHostID("a.example.com")
+	assert.True(t, found)
+	assert.Equal(t, "1", hostID)
+
+	expired := NewProxyCache(-time.Second)
+	expired.SetHostID("a.example.com", "1")
+	_, found = expired.GetHostID("a.example.com")
+	assert.False(t, found)
+	assert.Equal(t, 0, expired.hostCache.len())
+}
+
+func TestProxyCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewProxyCache(time.Minute)
+	cache.hostCache = newLRUCache[string, *cachedConfig](2, nil)
+
+	cache.SetHostID("a.example.com", "1")
+	cache.SetHostID("b.example.com", "1")
+	cache.GetHostID("a.example.com")
+	cache.SetHostID("c.example.com", "2")
+
+	_, found := cache.GetHostID("a.example.com")
+	assert.True(t, found)
+	_, found = cache.GetHostID("b.example.com")
+	assert.False(t, found)
+	_, found = cache.GetHostID("c.example.com")
+	assert.True(t, found)
+}
@@ -3,3 +3,5 @@ package proxy
 import "errors"
 
 var ErrNoRouteFound = errors.New("no route found")
+
+var ErrNoHealthyBackend = errors.New("no healthy backend")
@@ -0,0 +1,113 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// weight of the newest sample in the moving averages
+	ewmaAlpha = 0.2
+	// share of requests sent to a random backend so slower ones keep
+	// being measured and win traffic back once they recover
+	ewmaProbeRate = 0.05
+	// an error rate of 100% makes a backend look this many times slower
+	ewmaErrorPenalty = 10
+)
+
+// backendStats holds moving averages of response latency and error rate
+// for one backend.
+type backendStats struct {
+	mu      sync.Mutex
+	latency float64 // nanoseconds
+	errors  float64 // 0..1
+	sampled bool
+}
+
+func (s *backendStats) observe(latency time.Duration, failed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	errSample := 0.0
+	if failed {
+		errSample = 1
+	}
+
+	if !s.sampled {
+		s.latency, s.errors, s.sampled = float64(latency), errSample, true
+		return
+	}
+	s.latency += ewmaAlpha * (float64(latency) - s.latency)
+	s.errors += ewmaAlpha * (errSample - s.errors)
+}
+
+// cost is the penalised latency; unmeasured backends cost nothing so they
+// are tried first.
+func (s *backendStats) cost() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.latency * (1 + ewmaErrorPenalty*s.errors)
+}
+
+// observedTransport records the time to response headers, and whether
+// the backend failed, for every round trip to backend. The results feed
+// the EWMA balancer and the backend's circuit breaker through ticket, if
+// any.
+type observedTransport struct {
+	http.RoundTripper
+	backend Backend
+	ticket  *breakerTicket
+}
+
+func observe(rt http.RoundTripper, backend Backend, ticket *breakerTicket) http.RoundTripper {
+	return &observedTransport{RoundTripper: rt, backend: backend, ticket: ticket}
+}
+
+func (t *observedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	res, err := t.RoundTripper.RoundTrip(req)
+
+	// the client going away says nothing about the backend
+	if err != nil && errors.Is(err, context.Canceled) {
+		t.ticket.release()
+		return res, err
+	}
+
+	latency := time.Since(start)
+	failed := err != nil || res.StatusCode >= http.StatusInternalServerError
+	stateFor(t.backend).stats.observe(latency, failed)
+	t.ticket.record(latency, failed)
+	return res, err
+}
+
+// ewmaBalancer prefers the backend with the lowest latency, penalised by
+// its error rate and divided by its weight.
+type ewmaBalancer struct {
+	nextIdx atomic.Uint64
+}
+
+func (b *ewmaBalancer) Next(r *http.Request, backends []Backend) Backend {
+	if len(backends) > 1 && rand.Float64() < ewmaProbeRate {
+		return backends[rand.IntN(len(backends))]
+	}
+
+	// rotate the scan start so ties, e.g. before any sample, are spread
+	offset := int(b.nextIdx.Add(1) % uint64(len(backends)))
+
+	best := backends[offset]
+	bestCost := stateFor(best).stats.cost() / float64(best.effectiveWeight())
+	for i := 1; i < len(backends); i++ {
+		backend := backends[(offset+i)%len(backends)]
+		cost := stateFor(backend).stats.cost() / float64(backend.effectiveWeight())
+		if cost < bestCost {
+			best, bestCost = backend, cost
+		}
+	}
+	return best
+}
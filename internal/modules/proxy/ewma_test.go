@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEWMABalancerPrefersFastBackend(t *testing.T) {
+	backends := []Backend{{ID: "ewma-far"}, {ID: "ewma-near"}, {ID: "ewma-flaky"}}
+	for range 10 {
+		stateFor(backends[0]).stats.observe(80*time.Millisecond, false)
+		stateFor(backends[1]).stats.observe(5*time.Millisecond, false)
+		stateFor(backends[2]).stats.observe(2*time.Millisecond, true)
+	}
+
+	balancer := newBalancer(ProxyModel{LBAlgorithm: BalancerEWMA}, backends)
+	counts := map[string]int{}
+	for range 2000 {
+		counts[balancer.Next(nil, backends).ID]++
+	}
+
+	assert.Greater(t, counts["ewma-near"], 1800)
+	// slower backends are still probed now and then
+	assert.NotZero(t, counts["ewma-far"])
+	assert.NotZero(t, counts["ewma-flaky"])
+}
+
+func TestObservedTransportRecordsFailures(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer upstream.Close()
+
+	backend := Backend{ID: "ewma-observed"}
+	req, err := http.NewRequest(http.MethodGet, upstream.URL, nil)
+	assert.NoError(t, err)
+	res, err := observe(http.DefaultTransport, backend, nil).RoundTrip(req)
+	assert.NoError(t, err)
+	res.Body.Close()
+
+	stats := &stateFor(backend).stats
+	assert.True(t, stats.sampled)
+	assert.Equal(t, 1.0, stats.errors)
+}
@@ -0,0 +1,28 @@
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// gRPC status codes used for proxy generated errors.
+const (
+	grpcUnavailable      = 14
+	grpcDeadlineExceeded = 4
+)
+
+func isGRPC(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// writeGRPCError answers a gRPC call with a trailers-only response, the
+// form gRPC clients expect, instead of an HTTP error page they cannot
+// decode.
+func writeGRPCError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	w.Header().Set("Grpc-Message", url.PathEscape(message))
+	w.WriteHeader(http.StatusOK)
+}
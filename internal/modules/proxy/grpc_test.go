@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestH2CBackend(t *testing.T) {
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Write([]byte(r.Proto))
+		w.Header().Set("Grpc-Status", "0")
+	}))
+	upstream.Config.Protocols = new(http.Protocols)
+	upstream.Config.Protocols.SetUnencryptedHTTP2(true)
+	upstream.Start()
+	defer upstream.Close()
+
+	backend := backendFor(t, upstream)
+	backend.Scheme = SchemeH2C
+	handler := NewHandler(&stubService{target: &SelectedTarget{Backend: backend}})
+
+	server := httptest.NewServer(http.HandlerFunc(handler.HandleRequest))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/pkg.Service/Method", strings.NewReader("msg"))
+	req.Header.Set("Content-Type", "application/grpc")
+	res, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer res.Body.Close()
+
+	body, _ := io.ReadAll(res.Body)
+	assert.Equal(t, "HTTP/2.0", string(body))
+	assert.Equal(t, "0", res.Trailer.Get("Grpc-Status"))
+}
+
+func TestGRPCErrorOnUnreachableBackend(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := ln.Addr().(*net.TCPAddr)
+	ln.Close()
+
+	handler := NewHandler(&stubService{target: &SelectedTarget{
+		Backend: Backend{Scheme: SchemeH2C, Host: addr.IP.String(), Port: addr.Port},
+	}})
+
+	r := httptest.NewRequest(http.MethodPost, "/pkg.Service/Method", strings.NewReader("msg"))
+	r.Header.Set("Content-Type", "application/grpc")
+	w := httptest.NewRecorder()
+	handler.HandleRequest(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "14", w.Header().Get("Grpc-Status"))
+	assert.NotEmpty(t, w.Header().Get("Grpc-Message"))
+}
@@ -2,48 +2,19 @@ package proxy
 
 import (
 	"context"
-	"crypto/tls"
 	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net"
 	"net/http"
 	"net/http/httputil"
-	"time"
+	"strconv"
+	"sync"
 
 	"github.com/mimamch/reverse-proxy/internal/utils"
 )
 
-var transport = &http.Transport{
-	// ===== Connection reuse (keepalive) =====
-	MaxIdleConns:        4096,
-	MaxIdleConnsPerHost: 512,
-	MaxConnsPerHost:     0,
-	IdleConnTimeout:     120 * time.Second, // keepalive_timeout
-
-	// ===== Timeouts =====
-	// ResponseHeaderTimeout: 60 * time.Second, // proxy_read_timeout
-	// ExpectContinueTimeout: 1 * time.Second,
-
-	// ===== Dialing =====
-	DialContext: (&net.Dialer{
-		Timeout:   5 * time.Second,  // proxy_connect_timeout
-		KeepAlive: 30 * time.Second, // tcp_keepalive_time
-	}).DialContext,
-
-	// ===== HTTP/2 =====
-	ForceAttemptHTTP2: true, // nginx http2 on;
-
-	// ===== TLS (upstream) =====
-	TLSHandshakeTimeout: 10 * time.Second,
-	TLSClientConfig: &tls.Config{
-		MinVersion: tls.VersionTLS12,
-	},
-
-	// ===== Disable compression (match nginx proxy) =====
-	DisableCompression: true,
-}
-
 type Handler struct {
 	service Service
 }
@@ -56,18 +27,34 @@ func NewHandler(service Service) *Handler {
 
 func (h *Handler) HandleRequest(w http.ResponseWriter, r *http.Request) {
 
-	target, err := h.service.GetTarget(r.Host)
+	target, err := h.service.GetTarget(r)
 
 	if err != nil {
 		if errors.Is(err, ErrNoRouteFound) {
 			http.Error(w, "Service not found", http.StatusNotFound)
 			return
 		}
+		if errors.Is(err, ErrNoHealthyBackend) {
+			http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		var openErr *CircuitOpenError
+		if errors.As(err, &openErr) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(openErr.RetryAfter.Seconds()))))
+			http.Error(w, "Service unavailable", openErr.Status)
+			return
+		}
 		log.Printf("Error getting target for host %s: %v", r.Host, err)
 		http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
 		return
 	}
 
+	defer target.ticket.release()
+
+	for _, cookie := range target.Cookies {
+		http.SetCookie(w, cookie)
+	}
+
 	// if http and target requires https, redirect
 	if r.TLS == nil && target.ForceHTTPS {
 		redirectURL := fmt.Sprintf("https://%s%s", r.Host, r.RequestURI)
@@ -75,41 +62,108 @@ func (h *Handler) HandleRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if target.Redirect != nil {
+		http.Redirect(w, r, target.Redirect.Location(r), target.Redirect.Status)
+		return
+	}
+
+	if target.Backend.Scheme == SchemeFile {
+		fileURL := *r.URL
+		if target.Rewrite != nil {
+			target.Rewrite.Apply(&fileURL)
+		}
+		if cookie := target.affinity.forBackend(r, target.Backend); cookie != nil {
+			http.SetCookie(w, cookie)
+		}
+		serveStatic(w, r, target.Backend, fileURL.Path)
+		return
+	}
+
+	mirrors := sampleMirrors(target.Mirrors)
+	var body *mirrorBody
+	if len(mirrors) > 0 && r.Body != nil && r.Body != http.NoBody {
+		body = newMirrorBody(r.Body, target.MirrorBodyLimit)
+		r.Body = body
+	}
+
+	var replay *retryBody
+	if target.Retry != nil {
+		target.Retry.budget.request()
+		if r.Body != nil && r.Body != http.NoBody {
+			replay = newRetryBody(r.Body)
+		}
+	}
+
+	proxyTo(w, r, target, target.Backend, target.ticket, replay, nil)
+
+	if len(mirrors) > 0 {
+		sendMirrors(r, target, mirrors, body)
+	}
+}
+
+// proxyTo serves r from backend. When the backend fails before answering
+// and the retry policy allows it, it starts over on another backend of the
+// pool; tried lists the backends that failed already. ticket is the
+// backend's pass through its circuit.
+func proxyTo(w http.ResponseWriter, r *http.Request, target *SelectedTarget, backend Backend, ticket *breakerTicket, body *retryBody, tried []Backend) {
+	tried = append(tried, backend)
+	defer ticket.release()
+	done := sync.OnceFunc(trackInFlight(backend))
+	defer done()
+
+	transport := withTryTimeout(transportFor(backend, target.ServerName(r)), target.Retry.tryTimeout())
+
 	proxy := &httputil.ReverseProxy{
-		Transport: transport,
+		Transport: observe(transport, backend, ticket),
 		Director: func(req *http.Request) {
+			direct(req, r, target, backend)
+		},
+		ModifyResponse: func(res *http.Response) error {
+			target.Outlier.record(backend, res.StatusCode >= http.StatusInternalServerError)
 
-			req.URL.Scheme = target.Backend.Scheme
+			// pin the client to the backend that answered, even on a retry
+			if cookie := target.affinity.forBackend(r, backend); cookie != nil {
+				res.Header.Add("Set-Cookie", cookie.String())
+			}
 
-			req.URL.Host = target.Backend.Host
-			if target.Backend.Port != 0 {
-				req.URL.Host = net.JoinHostPort(target.Backend.Host, fmt.Sprintf("%d", target.Backend.Port))
+			// HTTP/1.1 can only carry trailers in a chunked body
+			if len(res.Trailer) > 0 {
+				res.Header.Del("Content-Length")
+				res.ContentLength = -1
 			}
+			return nil
+		},
 
-			// req.Host = target.Backend.Host
-			// if _, ok := target.Headers["Host"]; ok {
-			// 	req.Host = target.Headers["Host"]
-			// }
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
 
-			for key, val := range target.Headers {
-				req.Header.Set(key, val)
+			if errors.Is(err, context.Canceled) {
+				return
 			}
 
-			realIp := utils.GetRealClientIP(r)
+			if !errors.Is(err, context.DeadlineExceeded) {
+				target.Outlier.record(backend, true)
+			}
 
-			req.Header.Set("X-Forwarded-Host", req.Host)
-			req.Header.Set("X-Forwarded-Proto", req.URL.Scheme)
-			req.Header.Set("X-Forwarded-For", realIp.String())
-			req.Header.Set("X-Real-IP", realIp.String())
-		},
-		ModifyResponse: func(r *http.Response) error {
-			return nil
-		},
+			if target.Retry.canRetry(r, body, len(tried), err) {
+				if next, nextTicket, ok := target.Pool.NextExcluding(r, tried); ok {
+					log.Printf("Proxy Error, retrying on %s: %v", backendAddr(next), err)
+					done()
+					proxyTo(w, r, target, next, nextTicket, body, tried)
+					return
+				}
+			}
 
-		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			if isGRPC(req) {
+				code := grpcUnavailable
+				if errors.Is(err, context.DeadlineExceeded) {
+					code = grpcDeadlineExceeded
+				}
+				log.Printf("Proxy Error (grpc-status %d): %v", code, err)
+				writeGRPCError(w, code, "upstream: "+err.Error())
+				return
+			}
 
-			if errors.Is(err, context.Canceled) ||
-				errors.Is(err, context.DeadlineExceeded) {
+			if errors.Is(err, context.DeadlineExceeded) {
 				return
 			}
 
@@ -119,5 +173,53 @@ func (h *Handler) HandleRequest(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
+	if body != nil {
+		r.Body = body.reader()
+	}
+	if backend.ProxyProtocol != 0 {
+		src, dst := clientProxyAddrs(r)
+		r = r.WithContext(withProxyAddrs(r.Context(), src, dst))
+	}
+
 	proxy.ServeHTTP(w, r)
 }
+
+// direct points req at backend, applying the target's path rewrite, Host
+// header policy and headers. client is the incoming request.
+func direct(req *http.Request, client *http.Request, target *SelectedTarget, backend Backend) {
+	req.URL.Scheme = upstreamScheme(backend)
+	req.URL.Host = backendAddr(backend)
+
+	if target.Rewrite != nil {
+		target.Rewrite.Apply(req.URL)
+	}
+	joinBackendPath(req.URL, backend)
+
+	switch target.HostHeaderMode {
+	case HostHeaderBackend:
+		req.Host = "" // falls back to req.URL.Host
+	case HostHeaderFixed:
+		req.Host = target.HostHeaderValue
+	}
+
+	for key, val := range target.Headers {
+		req.Header.Set(key, val)
+	}
+
+	realIp := utils.GetRealClientIP(client)
+
+	req.Header.Set("X-Forwarded-Host", client.Host)
+	req.Header.Set("X-Forwarded-Proto", req.URL.Scheme)
+	req.Header.Set("X-Forwarded-For", realIp.String())
+	req.Header.Set("X-Real-IP", realIp.String())
+}
+
+func backendAddr(backend Backend) string {
+	if backend.Scheme == SchemeUnix {
+		return "localhost" // the socket transport ignores the address
+	}
+	if backend.Port != 0 {
+		return net.JoinHostPort(backend.Host, fmt.Sprintf("%d", backend.Port))
+	}
+	return backend.Host
+}
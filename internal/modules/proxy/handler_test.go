@@ -0,0 +1,41 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type stubService struct {
+	target     *SelectedTarget
+	tcpProxies []ProxyModel
+}
+
+func (s *stubService) GetTarget(r *http.Request) (*SelectedTarget, error) {
+	target := *s.target
+	return &target, nil
+}
+
+func (s *stubService) GetTCPTarget(proxyID string) (Backend, error) {
+	return s.target.Backend, nil
+}
+
+func (s *stubService) GetPassthroughTarget(serverName string) (Backend, bool, error) {
+	return s.target.Backend, s.target.Backend.Host != "", nil
+}
+
+func (s *stubService) ListTCPProxies() ([]ProxyModel, error) {
+	return s.tcpProxies, nil
+}
+
+func backendFor(t *testing.T, server *httptest.Server) Backend {
+	u, err := url.Parse(server.URL)
+	assert.NoError(t, err)
+	port, err := strconv.Atoi(u.Port())
+	assert.NoError(t, err)
+	return Backend{Scheme: u.Scheme, Host: u.Hostname(), Port: port}
+}
@@ -0,0 +1,132 @@
+package proxy
+
+import (
+	"hash/fnv"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/mimamch/reverse-proxy/internal/utils"
+)
+
+const (
+	HashKeyIP     = "ip"     // real client IP (default)
+	HashKeyHeader = "header" // request header named by HashKeyName
+	HashKeyCookie = "cookie" // cookie named by HashKeyName
+	HashKeyPath   = "path"   // request path
+)
+
+// points per unit of weight on the ring; more points spread keys more
+// evenly at the cost of a larger ring
+const ringPointsPerWeight = 160
+
+// ringHashBalancer maps a request key onto a hash ring of backend points.
+// Points are derived from backend IDs, so adding or removing a backend only
+// moves the keys that land next to its points. The ring holds every
+// configured backend and is built once per pool; keys landing on a backend
+// that is not available move on to the next point clockwise. Requests
+// without a key, and layer-4 connections, are balanced randomly.
+type ringHashBalancer struct {
+	key     string
+	keyName string
+	ring    []ringPoint
+}
+
+type ringPoint struct {
+	hash uint64
+	id   string
+}
+
+func newRingHashBalancer(proxy ProxyModel, backends []Backend) *ringHashBalancer {
+	return &ringHashBalancer{
+		key:     proxy.HashKey,
+		keyName: proxy.HashKeyName,
+		ring:    buildRing(backends),
+	}
+}
+
+func (b *ringHashBalancer) Next(r *http.Request, backends []Backend) Backend {
+	key, ok := b.requestKey(r)
+	if !ok {
+		return randomBalancer{}.Next(r, backends)
+	}
+
+	hash := hashKey(key)
+	start, _ := slices.BinarySearchFunc(b.ring, hash, func(p ringPoint, h uint64) int {
+		switch {
+		case p.hash < h:
+			return -1
+		case p.hash > h:
+			return 1
+		}
+		return 0
+	})
+	for i := range b.ring {
+		point := b.ring[(start+i)%len(b.ring)] // wraps around
+		idx := slices.IndexFunc(backends, func(backend Backend) bool { return backend.ID == point.id })
+		if idx >= 0 {
+			return backends[idx]
+		}
+	}
+	return randomBalancer{}.Next(r, backends)
+}
+
+func (b *ringHashBalancer) requestKey(r *http.Request) (string, bool) {
+	if r == nil {
+		return "", false
+	}
+
+	var key string
+	switch b.key {
+	case HashKeyHeader:
+		key = r.Header.Get(b.keyName)
+	case HashKeyCookie:
+		if cookie, err := r.Cookie(b.keyName); err == nil {
+			key = cookie.Value
+		}
+	case HashKeyPath:
+		key = r.URL.Path
+	default:
+		if ip := utils.GetRealClientIP(r); ip != nil {
+			key = ip.String()
+		}
+	}
+	return key, key != ""
+}
+
+func buildRing(backends []Backend) []ringPoint {
+	var ring []ringPoint
+	for _, backend := range backends {
+		for i := range backend.effectiveWeight() * ringPointsPerWeight {
+			ring = append(ring, ringPoint{
+				hash: hashKey(backend.ID + "#" + strconv.Itoa(i)),
+				id:   backend.ID,
+			})
+		}
+	}
+	slices.SortFunc(ring, func(a, b ringPoint) int {
+		switch {
+		case a.hash < b.hash:
+			return -1
+		case a.hash > b.hash:
+			return 1
+		}
+		return 0
+	})
+	return ring
+}
+
+// hashKey is FNV-1a finished with a 64-bit mixer, since FNV alone spreads
+// short, similar keys such as "id#1", "id#2" poorly. It is stable across
+// restarts and instances, unlike maphash.
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
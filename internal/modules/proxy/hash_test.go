@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRingHashBalancerIsSticky(t *testing.T) {
+	backends := []Backend{{ID: "a"}, {ID: "b"}, {ID: "c"}}
+	balancer := newBalancer(ProxyModel{LBAlgorithm: BalancerHash, HashKey: HashKeyHeader, HashKeyName: "X-Tenant"}, backends)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Tenant", "acme")
+	first := balancer.Next(r, backends)
+	for range 20 {
+		assert.Equal(t, first.ID, balancer.Next(r, backends).ID)
+	}
+}
+
+func TestRingHashBalancerStableOnMembershipChange(t *testing.T) {
+	before := []Backend{{ID: "a"}, {ID: "b"}, {ID: "c"}, {ID: "d"}}
+	after := []Backend{{ID: "a"}, {ID: "b"}, {ID: "c"}, {ID: "d"}, {ID: "e"}}
+	model := ProxyModel{LBAlgorithm: BalancerHash, HashKey: HashKeyPath}
+	balancer, reloaded := newBalancer(model, before), newBalancer(model, after)
+
+	moved := 0
+	for i := range 1000 {
+		r := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/objects/%d", i), nil)
+		old := balancer.Next(r, before)
+		now := reloaded.Next(r, after)
+		if old.ID != now.ID {
+			moved++
+			// keys only ever move to the new backend
+			assert.Equal(t, "e", now.ID)
+		}
+	}
+	// about a fifth of the keys belong on the new backend
+	assert.InDelta(t, 200, moved, 80)
+}
+
+func TestRingHashBalancerClientIP(t *testing.T) {
+	backends := []Backend{{ID: "a"}, {ID: "b"}}
+	balancer := newBalancer(ProxyModel{LBAlgorithm: BalancerHash}, backends)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "198.51.100.23:40000"
+	first := balancer.Next(r, backends)
+
+	r = httptest.NewRequest(http.MethodGet, "/other", nil)
+	r.RemoteAddr = "198.51.100.23:40001"
+	assert.Equal(t, first.ID, balancer.Next(r, backends).ID)
+}
+
+func TestRingHashBalancerSkipsUnavailableBackends(t *testing.T) {
+	backends := []Backend{{ID: "a"}, {ID: "b"}, {ID: "c"}, {ID: "d"}}
+	available := []Backend{backends[0], backends[1], backends[3]}
+	balancer := newBalancer(ProxyModel{LBAlgorithm: BalancerHash, HashKey: HashKeyPath}, backends)
+
+	moved := 0
+	for i := range 1000 {
+		r := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/objects/%d", i), nil)
+		all := balancer.Next(r, backends)
+		some := balancer.Next(r, available)
+		assert.NotEqual(t, "c", some.ID)
+		if all.ID != some.ID {
+			moved++
+			// only the keys of the unavailable backend move
+			assert.Equal(t, "c", all.ID)
+		}
+	}
+	assert.InDelta(t, 250, moved, 80)
+}
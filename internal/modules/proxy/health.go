@@ -0,0 +1,204 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"reflect"
+	"time"
+)
+
+// how often the checker reloads health check settings and backends
+const healthCheckReloadInterval = 30 * time.Second
+
+// HealthCheck is a proxy's active health check settings.
+type HealthCheck struct {
+	Path               string
+	Interval           time.Duration
+	Timeout            time.Duration
+	StatusMin          int
+	StatusMax          int
+	HealthyThreshold   int
+	UnhealthyThreshold int
+}
+
+// HealthCheckTarget is one backend probed with its proxy's settings.
+type HealthCheckTarget struct {
+	Check   HealthCheck
+	Backend Backend
+}
+
+func newHealthCheck(proxy ProxyModel) HealthCheck {
+	check := HealthCheck{
+		Path:               proxy.HealthCheckPath,
+		Interval:           time.Duration(proxy.HealthCheckInterval) * time.Second,
+		Timeout:            time.Duration(proxy.HealthCheckTimeout) * time.Second,
+		StatusMin:          proxy.HealthCheckStatusMin,
+		StatusMax:          proxy.HealthCheckStatusMax,
+		HealthyThreshold:   max(proxy.HealthCheckHealthyThreshold, 1),
+		UnhealthyThreshold: max(proxy.HealthCheckUnhealthyThreshold, 1),
+	}
+	if check.Interval <= 0 {
+		check.Interval = 10 * time.Second
+	}
+	if check.Timeout <= 0 || check.Timeout > check.Interval {
+		check.Timeout = min(2*time.Second, check.Interval)
+	}
+	if check.StatusMin == 0 && check.StatusMax == 0 {
+		check.StatusMin, check.StatusMax = 200, 399
+	}
+	return check
+}
+
+// isHealthy reports the result of active checks. Backends never checked,
+// e.g. on proxies without health checks, are healthy.
+func isHealthy(backend Backend) bool {
+	return !stateFor(backend).down.Load()
+}
+
+func setHealthy(backend Backend, healthy bool) {
+	if stateFor(backend).down.Swap(!healthy) == healthy {
+		log.Printf("Backend %s (%s) is now %s", backend.ID, backendAddr(backend), healthLabel(healthy))
+	}
+}
+
+func healthLabel(healthy bool) string {
+	if healthy {
+		return "healthy"
+	}
+	return "unhealthy"
+}
+
+// HealthChecker probes every enabled backend of proxies with a health
+// check path in the background.
+type HealthChecker struct {
+	repository Repository
+	probes     map[string]*healthProbe // by backend ID
+}
+
+type healthProbe struct {
+	target HealthCheckTarget
+	cancel context.CancelFunc
+}
+
+func NewHealthChecker(repository Repository) *HealthChecker {
+	return &HealthChecker{
+		repository: repository,
+		probes:     make(map[string]*healthProbe),
+	}
+}
+
+// Run keeps the probes in line with the database until ctx is done.
+func (c *HealthChecker) Run(ctx context.Context) {
+	ticker := time.NewTicker(healthCheckReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		targets, err := c.repository.ListHealthCheckTargets()
+		if err != nil {
+			log.Printf("Error loading health checks: %v", err)
+		} else {
+			c.sync(ctx, targets)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sync starts probes for new or changed targets and stops the rest.
+func (c *HealthChecker) sync(ctx context.Context, targets []HealthCheckTarget) {
+	seen := make(map[string]bool, len(targets))
+	for _, target := range targets {
+		if target.Backend.Scheme == SchemeFile {
+			continue
+		}
+		id := target.Backend.ID
+		seen[id] = true
+
+		if probe, ok := c.probes[id]; ok {
+			if reflect.DeepEqual(probe.target, target) {
+				continue
+			}
+			probe.cancel()
+		}
+
+		probeCtx, cancel := context.WithCancel(ctx)
+		c.probes[id] = &healthProbe{target: target, cancel: cancel}
+		go runHealthProbe(probeCtx, target)
+	}
+
+	for id, probe := range c.probes {
+		if !seen[id] {
+			probe.cancel()
+			delete(c.probes, id)
+			stateFor(probe.target.Backend).down.Store(false)
+		}
+	}
+}
+
+func runHealthProbe(ctx context.Context, target HealthCheckTarget) {
+	ticker := time.NewTicker(target.Check.Interval)
+	defer ticker.Stop()
+
+	successes, failures := 0, 0
+	for {
+		healthy := checkHealth(ctx, target)
+		if ctx.Err() != nil {
+			return // stopped mid-check, the result no longer applies
+		}
+
+		if healthy {
+			successes, failures = successes+1, 0
+			if successes == target.Check.HealthyThreshold {
+				setHealthy(target.Backend, true)
+			}
+		} else {
+			successes, failures = 0, failures+1
+			if failures == target.Check.UnhealthyThreshold {
+				setHealthy(target.Backend, false)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkHealth sends one probe, a GET to the check path under the backend's
+// base path and query, through the transport requests to it use.
+func checkHealth(ctx context.Context, target HealthCheckTarget) bool {
+	ctx, cancel := context.WithTimeout(ctx, target.Check.Timeout)
+	defer cancel()
+
+	probeURL, err := url.Parse(target.Check.Path)
+	if err != nil {
+		return false
+	}
+	probeURL.Scheme = upstreamScheme(target.Backend)
+	probeURL.Host = backendAddr(target.Backend)
+	joinBackendPath(probeURL, target.Backend)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, probeURL.String(), nil)
+	if err != nil {
+		return false
+	}
+	req.Header.Set("User-Agent", "reverse-proxy-health-check")
+
+	res, err := transportFor(target.Backend, "").RoundTrip(req)
+	if err != nil {
+		return false
+	}
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	res.Body.Close()
+
+	return res.StatusCode >= target.Check.StatusMin && res.StatusCode <= target.Check.StatusMax
+}
@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthCheckerThresholds(t *testing.T) {
+	var status atomic.Int64
+	status.Store(http.StatusOK)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/healthz", r.URL.Path)
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer upstream.Close()
+
+	addr := upstream.Listener.Addr().(*net.TCPAddr)
+	backend := Backend{ID: "health-1", Scheme: "http", Host: addr.IP.String(), Port: addr.Port}
+	target := HealthCheckTarget{
+		Check: HealthCheck{
+			Path:               "/healthz",
+			Interval:           10 * time.Millisecond,
+			Timeout:            10 * time.Millisecond,
+			StatusMin:          200,
+			StatusMax:          299,
+			HealthyThreshold:   2,
+			UnhealthyThreshold: 2,
+		},
+		Backend: backend,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	checker := NewHealthChecker(nil)
+	checker.sync(ctx, []HealthCheckTarget{target})
+
+	status.Store(http.StatusServiceUnavailable)
+	assert.Eventually(t, func() bool { return !isHealthy(backend) }, time.Second, 5*time.Millisecond)
+
+	status.Store(http.StatusNoContent)
+	assert.Eventually(t, func() bool { return isHealthy(backend) }, time.Second, 5*time.Millisecond)
+
+	// removed backends stop being probed and forget their state
+	status.Store(http.StatusServiceUnavailable)
+	assert.Eventually(t, func() bool { return !isHealthy(backend) }, time.Second, 5*time.Millisecond)
+	checker.sync(ctx, nil)
+	assert.Empty(t, checker.probes)
+	assert.True(t, isHealthy(backend))
+}
+
+func TestCheckHealthUsesBackendBase(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "app.sock")
+	ln, err := net.Listen("unix", socketPath)
+	assert.NoError(t, err)
+
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/app/healthz" || r.URL.RawQuery != "token=x&full=1" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})}
+	go server.Serve(ln)
+	defer server.Close()
+
+	check := HealthCheck{Path: "/healthz?full=1", Timeout: time.Second, StatusMin: 200, StatusMax: 299}
+	backend := Backend{ID: "health-unix", Scheme: SchemeUnix, Host: socketPath, Path: "/app", Query: "token=x"}
+	assert.True(t, checkHealth(context.Background(), HealthCheckTarget{Check: check, Backend: backend}))
+
+	backend.Path = ""
+	assert.False(t, checkHealth(context.Background(), HealthCheckTarget{Check: check, Backend: backend}))
+}
+
+func TestPoolSkipsUnhealthyBackends(t *testing.T) {
+	backends := []Backend{{ID: "health-a"}, {ID: "health-b"}}
+	pool := newPool(backends, nil, ProxyModel{})
+	defer backendStates.Delete("health-a")
+	defer backendStates.Delete("health-b")
+
+	setHealthy(backends[0], false)
+	for range 5 {
+		backend, _, _, err := pool.Next(nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "health-b", backend.ID)
+	}
+
+	setHealthy(backends[1], false)
+	_, _, _, err := pool.Next(nil)
+	assert.ErrorIs(t, err, ErrNoHealthyBackend)
+}
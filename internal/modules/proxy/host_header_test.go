@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// trustTLSServer makes the upstream transports trust server's certificate,
+// which covers example.com, *.example.com and 127.0.0.1, and gives the
+// test a fresh transport cache of size.
+func trustTLSServer(t *testing.T, server *httptest.Server, size int) {
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+
+	previous, previousTransports := transport.TLSClientConfig.RootCAs, transports
+	transport.TLSClientConfig.RootCAs = roots
+	transports = newLRUCache[transportKey, *http.Transport](size, func(t *http.Transport) {
+		t.CloseIdleConnections()
+	})
+	t.Cleanup(func() {
+		transport.TLSClientConfig.RootCAs = previous
+		transports = previousTransports
+	})
+}
+
+func TestHostHeaderPolicyAndSNI(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s|%s", r.Host, r.TLS.ServerName)
+	}))
+	defer upstream.Close()
+	trustTLSServer(t, upstream, maxTransports)
+
+	backend := backendFor(t, upstream)
+
+	cases := []struct {
+		name      string
+		target    SelectedTarget
+		url       string
+		clientSNI string
+		wantHost  string
+		wantSNI   string
+	}{
+		{
+			name:     "preserve sends the client host",
+			target:   SelectedTarget{HostHeaderMode: HostHeaderPreserve},
+			url:      "https://a.example.com/",
+			wantHost: "a.example.com",
+			wantSNI:  "a.example.com",
+		},
+		{
+			name:     "default mode is preserve",
+			target:   SelectedTarget{},
+			url:      "https://a.example.com/",
+			wantHost: "a.example.com",
+			wantSNI:  "a.example.com",
+		},
+		{
+			name:      "preserve prefers the client SNI",
+			target:    SelectedTarget{HostHeaderMode: HostHeaderPreserve},
+			url:       "https://a.example.com/",
+			clientSNI: "b.example.com",
+			wantHost:  "a.example.com",
+			wantSNI:   "b.example.com",
+		},
+		{
+			// an IP is no valid SNI, and the backend host is an IP too
+			name:     "preserve skips IP hosts",
+			target:   SelectedTarget{HostHeaderMode: HostHeaderPreserve},
+			url:      "http://127.0.0.1/",
+			wantHost: "127.0.0.1",
+			wantSNI:  "",
+		},
+		{
+			name:     "backend",
+			target:   SelectedTarget{HostHeaderMode: HostHeaderBackend},
+			url:      "https://a.example.com/",
+			wantHost: backendAddr(backend),
+			wantSNI:  "",
+		},
+		{
+			name:     "fixed",
+			target:   SelectedTarget{HostHeaderMode: HostHeaderFixed, HostHeaderValue: "api.example.com"},
+			url:      "https://a.example.com/",
+			wantHost: "api.example.com",
+			wantSNI:  "api.example.com",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			target := c.target
+			target.Backend = backend
+			handler := NewHandler(&stubService{target: &target})
+
+			req := httptest.NewRequest(http.MethodGet, c.url, nil)
+			if c.clientSNI != "" {
+				req.TLS.ServerName = c.clientSNI
+			}
+			w := httptest.NewRecorder()
+			handler.HandleRequest(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, c.wantHost+"|"+c.wantSNI, w.Body.String())
+		})
+	}
+}
+
+func TestClientSNIKeepsTransportsBounded(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+	trustTLSServer(t, upstream, 4)
+
+	handler := NewHandler(&stubService{target: &SelectedTarget{
+		Backend:        backendFor(t, upstream),
+		HostHeaderMode: HostHeaderPreserve,
+	}})
+
+	for i := range 10 {
+		w := httptest.NewRecorder()
+		handler.HandleRequest(w, httptest.NewRequest(http.MethodGet, fmt.Sprintf("https://tenant-%d.example.com/", i), nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	assert.Equal(t, 4, transports.len())
+}
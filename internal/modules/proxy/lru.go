@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"container/list"
+	"sync"
+)
+
+// lruCache is a map holding at most size entries. Adding to a full cache
+// drops the least recently used entry, passing its value to onEvict when
+// set.
+type lruCache[K comparable, V any] struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // of *lruEntry, most recently used first
+	entries map[K]*list.Element
+	onEvict func(V)
+}
+
+type lruEntry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+func newLRUCache[K comparable, V any](size int, onEvict func(V)) *lruCache[K, V] {
+	return &lruCache[K, V]{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[K]*list.Element),
+		onEvict: onEvict,
+	}
+}
+
+func (c *lruCache[K, V]) get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.order.MoveToFront(elem)
+		return elem.Value.(*lruEntry[K, V]).value, true
+	}
+	var zero V
+	return zero, false
+}
+
+func (c *lruCache[K, V]) add(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.addLocked(key, value)
+}
+
+// getOrAdd returns the value under key, adding the one made by create when
+// missing.
+func (c *lruCache[K, V]) getOrAdd(key K, create func() V) V {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.order.MoveToFront(elem)
+		return elem.Value.(*lruEntry[K, V]).value
+	}
+	value := create()
+	c.addLocked(key, value)
+	return value
+}
+
+func (c *lruCache[K, V]) addLocked(key K, value V) {
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*lruEntry[K, V]).value = value
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	if c.order.Len() >= c.size {
+		if oldest := c.order.Back(); oldest != nil {
+			c.removeElement(oldest)
+		}
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry[K, V]{key: key, value: value})
+}
+
+func (c *lruCache[K, V]) remove(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.removeElement(elem)
+	}
+}
+
+func (c *lruCache[K, V]) removeElement(elem *list.Element) {
+	entry := c.order.Remove(elem).(*lruEntry[K, V])
+	delete(c.entries, entry.key)
+	if c.onEvict != nil {
+		c.onEvict(entry.value)
+	}
+}
+
+func (c *lruCache[K, V]) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
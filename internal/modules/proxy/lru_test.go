@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRUCache(t *testing.T) {
+	var evicted []int
+	cache := newLRUCache[string, int](2, func(v int) { evicted = append(evicted, v) })
+
+	cache.add("a", 1)
+	cache.add("b", 2)
+	_, ok := cache.get("a") // b is now the least recently used
+	assert.True(t, ok)
+	cache.add("c", 3)
+
+	_, ok = cache.get("b")
+	assert.False(t, ok)
+	assert.Equal(t, []int{2}, evicted)
+	assert.Equal(t, 3, cache.getOrAdd("c", func() int { return 4 }))
+	assert.Equal(t, 2, cache.len())
+
+	cache.remove("a")
+	assert.Equal(t, 1, cache.len())
+	assert.Equal(t, []int{2, 1}, evicted)
+}
+
+func TestIsDNSName(t *testing.T) {
+	assert.True(t, isDNSName("app.example.com"))
+	assert.True(t, isDNSName("xn--bcher-kva.example"))
+	assert.False(t, isDNSName("127.0.0.1"))
+	assert.False(t, isDNSName("-bad.example.com"))
+	assert.False(t, isDNSName("a..example.com"))
+	assert.False(t, isDNSName("bad_name.example.com"))
+}
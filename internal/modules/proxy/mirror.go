@@ -0,0 +1,150 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultMirrorBodyLimit = 1 << 20 // 1 MiB
+
+	mirrorTimeout     = 30 * time.Second
+	maxMirrorRequests = 1024
+)
+
+// mirrorSlots bounds in-flight mirror requests; when full, copies are
+// dropped rather than queued so a slow mirror cannot build up memory.
+var mirrorSlots = make(chan struct{}, maxMirrorRequests)
+
+// Mirror receives a fire-and-forget copy of SamplePercent of a proxy's
+// requests. Its responses are discarded.
+type Mirror struct {
+	Backend       Backend
+	SamplePercent int
+}
+
+func sampleMirrors(mirrors []Mirror) []Mirror {
+	var sampled []Mirror
+	for _, mirror := range mirrors {
+		if mirror.SamplePercent >= 100 || rand.IntN(100) < mirror.SamplePercent {
+			sampled = append(sampled, mirror)
+		}
+	}
+	return sampled
+}
+
+// mirrorBody tees the request body into a buffer while the primary
+// request streams it upstream. Bodies larger than limit are not kept.
+type mirrorBody struct {
+	io.ReadCloser
+
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	limit    int64
+	overflow bool
+	complete bool
+}
+
+func newMirrorBody(body io.ReadCloser, limit int64) *mirrorBody {
+	return &mirrorBody{ReadCloser: body, limit: limit}
+}
+
+func (b *mirrorBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.overflow {
+		if int64(b.buf.Len()+n) > b.limit {
+			b.overflow = true
+			b.buf = bytes.Buffer{}
+		} else {
+			b.buf.Write(p[:n])
+		}
+	}
+	if err == io.EOF {
+		b.complete = true
+	}
+	return n, err
+}
+
+// bytes returns the full body, or false when it was too large or the
+// primary request did not read it to the end.
+func (b *mirrorBody) bytes() ([]byte, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.overflow || !b.complete {
+		return nil, false
+	}
+	return bytes.Clone(b.buf.Bytes()), true
+}
+
+// sendMirrors replays the finished request against every mirror in the
+// background. It never blocks and never touches the client response.
+func sendMirrors(r *http.Request, target *SelectedTarget, mirrors []Mirror, body *mirrorBody) {
+	if r.Header.Get("Upgrade") != "" {
+		return
+	}
+
+	var payload []byte
+	if body != nil {
+		var ok bool
+		if payload, ok = body.bytes(); !ok {
+			return
+		}
+	}
+
+	for _, mirror := range mirrors {
+		select {
+		case mirrorSlots <- struct{}{}:
+		default:
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), mirrorTimeout)
+		req := r.Clone(ctx)
+		req.RequestURI = ""
+		req.Body = http.NoBody
+		req.ContentLength = int64(len(payload))
+		if len(payload) > 0 {
+			req.Body = io.NopCloser(bytes.NewReader(payload))
+		}
+		for _, h := range hopHeaders {
+			req.Header.Del(h)
+		}
+		direct(req, r, target, mirror.Backend)
+
+		go func() {
+			defer func() { <-mirrorSlots }()
+			defer cancel()
+
+			res, err := transportFor(mirror.Backend, target.ServerName(r)).RoundTrip(req)
+			if err != nil {
+				log.Printf("Mirror Error: %v", err)
+				return
+			}
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}()
+	}
+}
+
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
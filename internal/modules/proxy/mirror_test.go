@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMirrorReceivesCopy(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte("primary:" + string(body)))
+	}))
+	defer primary.Close()
+
+	mirrored := make(chan string, 1)
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mirrored <- r.URL.Path + ":" + string(body)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer mirror.Close()
+
+	handler := NewHandler(&stubService{target: &SelectedTarget{
+		Backend:         backendFor(t, primary),
+		Mirrors:         []Mirror{{Backend: backendFor(t, mirror), SamplePercent: 100}},
+		MirrorBodyLimit: DefaultMirrorBodyLimit,
+	}})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "http://example.com/orders", strings.NewReader("payload"))
+	handler.HandleRequest(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "primary:payload", w.Body.String())
+
+	select {
+	case got := <-mirrored:
+		assert.Equal(t, "/orders:payload", got)
+	case <-time.After(5 * time.Second):
+		t.Fatal("mirror did not receive the request")
+	}
+}
+
+func TestMirrorBodySkipsOversizedBodies(t *testing.T) {
+	body := newMirrorBody(io.NopCloser(strings.NewReader("0123456789")), 4)
+	_, err := io.ReadAll(body)
+	assert.NoError(t, err)
+
+	_, ok := body.bytes()
+	assert.False(t, ok)
+}
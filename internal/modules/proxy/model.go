@@ -1,29 +1,132 @@
 package proxy
 
-import "time"
+import (
+	"net/http"
+	"regexp"
+	"time"
+)
 
 type Backend struct {
+	ID     string
 	Scheme string
-	Host   string
+	Host   string // directory for file backends, socket path for unix backends
 	Port   int
+	Path   string // base path the request path is mounted under
+	Query  string // fixed raw query prepended to the request query
+	Weight int    // relative share of traffic within its pool or group
+
+	ProxyProtocol int // PROXY protocol version sent upstream, 0 disables it
+
+	GroupID string
+
+	IndexFiles  []string
+	SPAFallback bool
+}
+
+type Matcher struct {
+	Type  string // header, query or cookie
+	Name  string
+	Value string
+	Regex *regexp.Regexp
+}
+
+type Route struct {
+	Path     string
+	Exact    bool
+	Priority int
+	Methods  []string
+	Matchers []Matcher
+	Rewrite  *Rewrite
+	Redirect *Redirect
+	Pool     *Pool
+	Headers  map[string]string
 }
 
+const (
+	HostHeaderPreserve = "preserve" // client Host (default)
+	HostHeaderBackend  = "backend"  // backend host[:port]
+	HostHeaderFixed    = "fixed"    // HostHeaderValue
+)
+
 type TargetConfig struct {
-	Backends   []Backend
-	Headers    map[string]string
-	ForceHTTPS bool
+	Pool            *Pool
+	Headers         map[string]string
+	ForceHTTPS      bool
+	TLSPassthrough  bool
+	Routes          []*Route // sorted, most specific first
+	Redirect        *Redirect
+	HostHeaderMode  string
+	HostHeaderValue string
+	Mirrors         []Mirror
+	MirrorBodyLimit int64
 }
 
 type SelectedTarget struct {
-	Backend    Backend
-	Headers    map[string]string
-	ForceHTTPS bool
+	Backend         Backend
+	ticket          *breakerTicket  // the backend's pass through its circuit
+	Cookies         []*http.Cookie  // set on the response, e.g. a sticky group
+	affinity        *affinityCookie // set from the backend that answers, nil when disabled
+	Pool            *Pool           // the backend's pool, to pick another one on retries
+	Outlier         *OutlierDetection
+	Retry           *RetryPolicy
+	Headers         map[string]string
+	ForceHTTPS      bool
+	Rewrite         *Rewrite
+	Redirect        *Redirect
+	HostHeaderMode  string
+	HostHeaderValue string
+	Mirrors         []Mirror
+	MirrorBodyLimit int64
 }
 
 type ProxyModel struct {
 	ID        string    `gorm:"primaryKey;column:id" json:"id"`
 	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
 	UpdatedAt time.Time `gorm:"column:updated_at" json:"updated_at"`
+
+	HostHeaderMode  string `gorm:"column:host_header_mode" json:"host_header_mode"`
+	HostHeaderValue string `gorm:"column:host_header_value" json:"host_header_value"`
+	GroupCookie     string `gorm:"column:group_cookie" json:"group_cookie"`
+	MirrorBodyLimit int64  `gorm:"column:mirror_body_limit" json:"mirror_body_limit"`
+	LBAlgorithm     string `gorm:"column:lb_algorithm" json:"lb_algorithm"`
+	HashKey         string `gorm:"column:hash_key" json:"hash_key"`           // hash balancer only
+	HashKeyName     string `gorm:"column:hash_key_name" json:"hash_key_name"` // header or cookie name
+	ListenPort      *int   `gorm:"column:listen_port" json:"listen_port"`     // set for layer-4 TCP proxies
+
+	AffinityCookie         string `gorm:"column:affinity_cookie" json:"affinity_cookie"`         // empty disables session affinity
+	AffinityCookieTTL      int    `gorm:"column:affinity_cookie_ttl" json:"affinity_cookie_ttl"` // seconds
+	AffinityCookiePath     string `gorm:"column:affinity_cookie_path" json:"affinity_cookie_path"`
+	AffinityCookieDomain   string `gorm:"column:affinity_cookie_domain" json:"affinity_cookie_domain"`
+	AffinityCookieSameSite string `gorm:"column:affinity_cookie_same_site" json:"affinity_cookie_same_site"`
+	AffinityCookieSecure   bool   `gorm:"column:affinity_cookie_secure" json:"affinity_cookie_secure"`
+	AffinityCookieHTTPOnly bool   `gorm:"column:affinity_cookie_http_only" json:"affinity_cookie_http_only"`
+
+	HealthCheckPath               string `gorm:"column:health_check_path" json:"health_check_path"`         // empty disables active checks
+	HealthCheckInterval           int    `gorm:"column:health_check_interval" json:"health_check_interval"` // seconds
+	HealthCheckTimeout            int    `gorm:"column:health_check_timeout" json:"health_check_timeout"`   // seconds
+	HealthCheckStatusMin          int    `gorm:"column:health_check_status_min" json:"health_check_status_min"`
+	HealthCheckStatusMax          int    `gorm:"column:health_check_status_max" json:"health_check_status_max"`
+	HealthCheckHealthyThreshold   int    `gorm:"column:health_check_healthy_threshold" json:"health_check_healthy_threshold"`
+	HealthCheckUnhealthyThreshold int    `gorm:"column:health_check_unhealthy_threshold" json:"health_check_unhealthy_threshold"`
+
+	OutlierConsecutiveFailures int `gorm:"column:outlier_consecutive_failures" json:"outlier_consecutive_failures"` // 0 disables outlier detection
+	OutlierBaseEjection        int `gorm:"column:outlier_base_ejection" json:"outlier_base_ejection"`               // seconds
+	OutlierMaxEjection         int `gorm:"column:outlier_max_ejection" json:"outlier_max_ejection"`                 // seconds
+	OutlierMaxEjectionPercent  int `gorm:"column:outlier_max_ejection_percent" json:"outlier_max_ejection_percent"`
+
+	RetryAttempts        int  `gorm:"column:retry_attempts" json:"retry_attempts"` // 0 disables retries
+	RetryPerTryTimeoutMs int  `gorm:"column:retry_per_try_timeout_ms" json:"retry_per_try_timeout_ms"`
+	RetryNonIdempotent   bool `gorm:"column:retry_non_idempotent" json:"retry_non_idempotent"`
+	RetryBudgetPercent   int  `gorm:"column:retry_budget_percent" json:"retry_budget_percent"`
+
+	BreakerErrorPercent     int `gorm:"column:breaker_error_percent" json:"breaker_error_percent"` // 0 disables the error rate trip
+	BreakerLatencyMs        int `gorm:"column:breaker_latency_ms" json:"breaker_latency_ms"`       // 0 disables the latency trip
+	BreakerWindow           int `gorm:"column:breaker_window" json:"breaker_window"`               // seconds
+	BreakerMinRequests      int `gorm:"column:breaker_min_requests" json:"breaker_min_requests"`
+	BreakerOpenDuration     int `gorm:"column:breaker_open_duration" json:"breaker_open_duration"` // seconds
+	BreakerHalfOpenRequests int `gorm:"column:breaker_half_open_requests" json:"breaker_half_open_requests"`
+	BreakerStatus           int `gorm:"column:breaker_status" json:"breaker_status"`
+	BreakerRetryAfter       int `gorm:"column:breaker_retry_after" json:"breaker_retry_after"` // seconds, 0 uses the time until the next probe
 }
 
 func (ProxyModel) TableName() string {
@@ -38,6 +141,14 @@ type HostModel struct {
 	ProxyID    string `gorm:"column:proxy_id" json:"proxy_id"`
 	Host       string `gorm:"column:host" json:"host"`
 	ForceHTTPS bool   `gorm:"column:force_https" json:"force_https"`
+
+	// the :443 listener splices TLS connections for this host straight to
+	// a backend instead of terminating them
+	TLSPassthrough bool `gorm:"column:tls_passthrough" json:"tls_passthrough"`
+
+	RedirectURL           string `gorm:"column:redirect_url" json:"redirect_url"`
+	RedirectStatus        int    `gorm:"column:redirect_status" json:"redirect_status"`
+	RedirectPreserveQuery bool   `gorm:"column:redirect_preserve_query" json:"redirect_preserve_query"`
 }
 
 func (HostModel) TableName() string {
@@ -49,27 +160,111 @@ type BackendModel struct {
 	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
 	UpdatedAt time.Time `gorm:"column:updated_at" json:"updated_at"`
 
-	Scheme  string `gorm:"column:scheme" json:"scheme"`
-	Host    string `gorm:"column:host" json:"host"`
-	Port    int    `gorm:"column:port" json:"port"`
-	ProxyID string `gorm:"column:proxy_id" json:"proxy_id"`
-	Enabled bool   `gorm:"column:enabled" json:"enabled"`
+	Scheme  string  `gorm:"column:scheme" json:"scheme"`
+	Host    string  `gorm:"column:host" json:"host"`
+	Port    int     `gorm:"column:port" json:"port"`
+	Path    string  `gorm:"column:path" json:"path"`
+	Query   string  `gorm:"column:query" json:"query"`
+	ProxyID string  `gorm:"column:proxy_id" json:"proxy_id"`
+	RouteID *string `gorm:"column:route_id" json:"route_id"`
+	GroupID *string `gorm:"column:group_id" json:"group_id"`
+	Enabled bool    `gorm:"column:enabled" json:"enabled"`
+	Weight  int     `gorm:"column:weight" json:"weight"`
+
+	ProxyProtocol int `gorm:"column:proxy_protocol" json:"proxy_protocol"`
+
+	// file backends only
+	IndexFiles  string `gorm:"column:index_files" json:"index_files"` // comma separated
+	SPAFallback bool   `gorm:"column:spa_fallback" json:"spa_fallback"`
 }
 
 func (BackendModel) TableName() string {
 	return "backends"
 }
 
-type HeadersModel struct {
+type BackendGroupModel struct {
 	ID        string    `gorm:"primaryKey;column:id" json:"id"`
 	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
 	UpdatedAt time.Time `gorm:"column:updated_at" json:"updated_at"`
 
 	ProxyID string `gorm:"column:proxy_id" json:"proxy_id"`
-	Key     string `gorm:"column:key" json:"key"`
-	Value   string `gorm:"column:value" json:"value"`
+	Name    string `gorm:"column:name" json:"name"`
+	Weight  int    `gorm:"column:weight" json:"weight"`
+}
+
+func (BackendGroupModel) TableName() string {
+	return "backend_groups"
+}
+
+type MirrorModel struct {
+	ID        string    `gorm:"primaryKey;column:id" json:"id"`
+	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at" json:"updated_at"`
+
+	ProxyID       string `gorm:"column:proxy_id" json:"proxy_id"`
+	Scheme        string `gorm:"column:scheme" json:"scheme"`
+	Host          string `gorm:"column:host" json:"host"`
+	Port          int    `gorm:"column:port" json:"port"`
+	SamplePercent int    `gorm:"column:sample_percent" json:"sample_percent"`
+	Enabled       bool   `gorm:"column:enabled" json:"enabled"`
+}
+
+func (MirrorModel) TableName() string {
+	return "mirrors"
+}
+
+type HeadersModel struct {
+	ID        string    `gorm:"primaryKey;column:id" json:"id"`
+	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at" json:"updated_at"`
+
+	ProxyID string  `gorm:"column:proxy_id" json:"proxy_id"`
+	RouteID *string `gorm:"column:route_id" json:"route_id"`
+	Key     string  `gorm:"column:key" json:"key"`
+	Value   string  `gorm:"column:value" json:"value"`
 }
 
 func (HeadersModel) TableName() string {
 	return "headers"
 }
+
+type RouteModel struct {
+	ID        string    `gorm:"primaryKey;column:id" json:"id"`
+	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at" json:"updated_at"`
+
+	HostID   string `gorm:"column:host_id" json:"host_id"`
+	Path     string `gorm:"column:path" json:"path"`
+	Exact    bool   `gorm:"column:exact" json:"exact"`
+	Priority int    `gorm:"column:priority" json:"priority"`
+	Methods  string `gorm:"column:methods" json:"methods"` // comma separated, empty matches any
+
+	StripPrefix        string `gorm:"column:strip_prefix" json:"strip_prefix"`
+	AddPrefix          string `gorm:"column:add_prefix" json:"add_prefix"`
+	RewriteRegex       string `gorm:"column:rewrite_regex" json:"rewrite_regex"`
+	RewriteReplacement string `gorm:"column:rewrite_replacement" json:"rewrite_replacement"`
+
+	RedirectURL           string `gorm:"column:redirect_url" json:"redirect_url"`
+	RedirectStatus        int    `gorm:"column:redirect_status" json:"redirect_status"`
+	RedirectPreserveQuery bool   `gorm:"column:redirect_preserve_query" json:"redirect_preserve_query"`
+}
+
+func (RouteModel) TableName() string {
+	return "routes"
+}
+
+type RouteMatcherModel struct {
+	ID        string    `gorm:"primaryKey;column:id" json:"id"`
+	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at" json:"updated_at"`
+
+	RouteID string `gorm:"column:route_id" json:"route_id"`
+	Type    string `gorm:"column:type" json:"type"`
+	Name    string `gorm:"column:name" json:"name"`
+	Value   string `gorm:"column:value" json:"value"`
+	Regex   bool   `gorm:"column:regex" json:"regex"`
+}
+
+func (RouteMatcherModel) TableName() string {
+	return "route_matchers"
+}
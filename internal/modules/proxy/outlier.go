@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// OutlierDetection ejects backends that fail live requests, without any
+// probe traffic. A backend is ejected after Consecutive failures in a row
+// (dial errors or 5xx responses) for BaseEjection times the number of times
+// it has been ejected, up to MaxEjection.
+type OutlierDetection struct {
+	Consecutive     int
+	BaseEjection    time.Duration
+	MaxEjection     time.Duration
+	MaxEjectPercent int // share of a pool's backends that may be ejected at once
+}
+
+func newOutlierDetection(proxy ProxyModel) *OutlierDetection {
+	if proxy.OutlierConsecutiveFailures <= 0 {
+		return nil
+	}
+
+	detection := &OutlierDetection{
+		Consecutive:     proxy.OutlierConsecutiveFailures,
+		BaseEjection:    time.Duration(proxy.OutlierBaseEjection) * time.Second,
+		MaxEjection:     time.Duration(proxy.OutlierMaxEjection) * time.Second,
+		MaxEjectPercent: min(max(proxy.OutlierMaxEjectionPercent, 0), 100),
+	}
+	if detection.BaseEjection <= 0 {
+		detection.BaseEjection = 30 * time.Second
+	}
+	if detection.MaxEjection < detection.BaseEjection {
+		detection.MaxEjection = max(300*time.Second, detection.BaseEjection)
+	}
+	return detection
+}
+
+type outlierState struct {
+	mu           sync.Mutex
+	failures     int // consecutive
+	ejections    int
+	ejectedUntil time.Time
+}
+
+// record counts the outcome of a request to backend. It is a no-op when
+// detection is disabled, i.e. d is nil.
+func (d *OutlierDetection) record(backend Backend, failed bool) {
+	if d == nil {
+		return
+	}
+
+	state := &stateFor(backend).outlier
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	now := time.Now()
+	if !failed {
+		state.failures = 0
+		// a backend healthy for a full max ejection starts from scratch
+		if state.ejections > 0 && now.After(state.ejectedUntil.Add(d.MaxEjection)) {
+			state.ejections = 0
+		}
+		return
+	}
+
+	state.failures++
+	if state.failures < d.Consecutive || now.Before(state.ejectedUntil) {
+		return
+	}
+
+	state.failures = 0
+	state.ejections++
+	duration := min(d.BaseEjection*time.Duration(state.ejections), d.MaxEjection)
+	state.ejectedUntil = now.Add(duration)
+	log.Printf("Backend %s (%s) ejected for %s after %d consecutive failures",
+		backend.ID, backendAddr(backend), duration, d.Consecutive)
+}
+
+func isEjected(backend Backend) bool {
+	state := &stateFor(backend).outlier
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	return time.Now().Before(state.ejectedUntil)
+}
@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutlierEjectionBackoff(t *testing.T) {
+	detection := &OutlierDetection{Consecutive: 3, BaseEjection: time.Minute, MaxEjection: 150 * time.Second}
+	backend := Backend{ID: "outlier-backoff"}
+	defer backendStates.Delete(backend.ID)
+
+	detection.record(backend, true)
+	detection.record(backend, true)
+	detection.record(backend, false) // a success resets the streak
+	detection.record(backend, true)
+	detection.record(backend, true)
+	assert.False(t, isEjected(backend))
+
+	detection.record(backend, true)
+	assert.True(t, isEjected(backend))
+
+	state := &stateFor(backend).outlier
+	assert.WithinDuration(t, time.Now().Add(time.Minute), state.ejectedUntil, time.Second)
+
+	// once the ejection is over, the next one lasts longer, up to the max
+	for _, want := range []time.Duration{2 * time.Minute, 150 * time.Second} {
+		state.ejectedUntil = time.Now()
+		for range 3 {
+			detection.record(backend, true)
+		}
+		assert.WithinDuration(t, time.Now().Add(want), state.ejectedUntil, time.Second)
+	}
+}
+
+func TestPoolCapsEjectedBackends(t *testing.T) {
+	backends := []Backend{{ID: "outlier-a"}, {ID: "outlier-b"}, {ID: "outlier-c"}, {ID: "outlier-d"}}
+	pool := newPool(backends, nil, ProxyModel{OutlierConsecutiveFailures: 1, OutlierMaxEjectionPercent: 50})
+	for _, backend := range backends {
+		defer backendStates.Delete(backend.ID)
+	}
+
+	for _, backend := range backends[:3] {
+		pool.Outlier.record(backend, true)
+	}
+
+	// three are ejected but only half of the pool may be left out
+	assert.Len(t, pool.available(pool.Backends), 2)
+	assert.Equal(t, []Backend{{ID: "outlier-c"}, {ID: "outlier-d"}}, pool.available(pool.Backends))
+}
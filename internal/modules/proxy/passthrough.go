@@ -0,0 +1,183 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mimamch/reverse-proxy/internal/utils"
+)
+
+const clientHelloTimeout = 5 * time.Second
+
+var errHelloPeeked = errors.New("client hello peeked")
+
+// PassthroughListener wraps the :443 listener. It reads the ClientHello of
+// every connection; connections for passthrough hosts are spliced to a
+// backend with TLS untouched, all others are returned from Accept with the
+// peeked bytes replayed, ready for the regular TLS server.
+type PassthroughListener struct {
+	net.Listener
+	service Service
+
+	conns     chan net.Conn
+	errs      chan error
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewPassthroughListener(ln net.Listener, service Service) net.Listener {
+	l := &PassthroughListener{
+		Listener: ln,
+		service:  service,
+		conns:    make(chan net.Conn),
+		errs:     make(chan error, 1),
+		done:     make(chan struct{}),
+	}
+	go l.acceptLoop()
+	return l
+}
+
+func (l *PassthroughListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case err := <-l.errs:
+		return nil, err
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *PassthroughListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+func (l *PassthroughListener) acceptLoop() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				time.Sleep(5 * time.Millisecond)
+				continue
+			}
+			select {
+			case l.errs <- err:
+			case <-l.done:
+			}
+			return
+		}
+
+		// peek in the background so one slow client cannot stall Accept
+		go l.route(conn)
+	}
+}
+
+func (l *PassthroughListener) route(conn net.Conn) {
+	conn.SetReadDeadline(time.Now().Add(clientHelloTimeout))
+	serverName, hello, err := peekServerName(conn)
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	replayed := &peekedConn{Conn: conn, r: io.MultiReader(bytes.NewReader(hello), conn)}
+
+	if serverName != "" {
+		backend, ok, err := l.service.GetPassthroughTarget(serverName)
+		if err != nil {
+			log.Printf("Error getting passthrough target for %s: %v", serverName, err)
+		}
+		if ok {
+			l.splice(replayed, backend)
+			return
+		}
+	}
+
+	select {
+	case l.conns <- replayed:
+	case <-l.done:
+		conn.Close()
+	}
+}
+
+func (l *PassthroughListener) splice(conn net.Conn, backend Backend) {
+	defer conn.Close()
+	defer trackInFlight(backend)()
+
+	upstream, err := dialBackend(context.Background(), backend)
+	if err != nil {
+		log.Printf("TLS Passthrough Error: %v", err)
+		return
+	}
+	defer upstream.Close()
+
+	if backend.ProxyProtocol != 0 {
+		if err := utils.WriteProxyHeader(upstream, backend.ProxyProtocol, conn.RemoteAddr(), conn.LocalAddr()); err != nil {
+			log.Printf("TLS Passthrough Error: %v", err)
+			return
+		}
+	}
+
+	pipe(conn, upstream)
+}
+
+// peekServerName reads the ClientHello from r and returns its SNI along
+// with every byte consumed, so the handshake can be replayed.
+func peekServerName(r io.Reader) (string, []byte, error) {
+	var buf bytes.Buffer
+	var serverName string
+
+	err := tls.Server(readOnlyConn{r: io.TeeReader(r, &buf)}, &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			serverName = hello.ServerName
+			return nil, errHelloPeeked
+		},
+	}).Handshake()
+
+	if !errors.Is(err, errHelloPeeked) {
+		return "", nil, err
+	}
+	return serverName, buf.Bytes(), nil
+}
+
+// readOnlyConn lets crypto/tls parse a ClientHello without answering it.
+type readOnlyConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c readOnlyConn) Read(p []byte) (int, error)         { return c.r.Read(p) }
+func (c readOnlyConn) Write(p []byte) (int, error)        { return 0, io.ErrClosedPipe }
+func (c readOnlyConn) Close() error                       { return nil }
+func (c readOnlyConn) LocalAddr() net.Addr                { return nil }
+func (c readOnlyConn) RemoteAddr() net.Addr               { return nil }
+func (c readOnlyConn) SetDeadline(t time.Time) error      { return nil }
+func (c readOnlyConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c readOnlyConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// peekedConn replays already consumed bytes before reading from Conn.
+type peekedConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *peekedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+func (c *peekedConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return c.Conn.Close()
+}
@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPassthroughSplicesTLS(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("from backend"))
+	}))
+	defer upstream.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	passthrough := NewPassthroughListener(ln, &stubService{target: &SelectedTarget{
+		Backend: backendFor(t, upstream),
+	}})
+	defer passthrough.Close()
+
+	conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{
+		ServerName:         "secure.example.com",
+		InsecureSkipVerify: true,
+	})
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	// the proxy never terminated TLS: the peer certificate is the backend's
+	assert.Equal(t, upstream.Certificate().Raw, conn.ConnectionState().PeerCertificates[0].Raw)
+
+	_, err = conn.Write([]byte("GET / HTTP/1.0\r\nHost: secure.example.com\r\n\r\n"))
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(conn)
+	assert.Contains(t, string(body), "from backend")
+}
+
+func TestPassthroughSplicesToUnixSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "app.sock")
+	socket, err := net.Listen("unix", socketPath)
+	assert.NoError(t, err)
+
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("from socket"))
+	}))
+	upstream.Listener.Close()
+	upstream.Listener = socket
+	upstream.StartTLS()
+	defer upstream.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	passthrough := NewPassthroughListener(ln, &stubService{target: &SelectedTarget{
+		Backend: Backend{Scheme: SchemeUnix, Host: socketPath},
+	}})
+	defer passthrough.Close()
+
+	conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{
+		ServerName:         "secure.example.com",
+		InsecureSkipVerify: true,
+	})
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("GET / HTTP/1.0\r\nHost: secure.example.com\r\n\r\n"))
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(conn)
+	assert.Contains(t, string(body), "from socket")
+}
+
+func TestPassthroughHandsOffOtherHosts(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	passthrough := NewPassthroughListener(ln, &stubService{target: &SelectedTarget{}})
+	defer passthrough.Close()
+
+	terminating := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("terminated " + r.TLS.ServerName))
+	}))
+	terminating.Listener = passthrough
+	terminating.StartTLS()
+	defer terminating.Close()
+
+	client := terminating.Client()
+	client.Transport.(*http.Transport).TLSClientConfig.ServerName = "example.com"
+	res, err := client.Get(terminating.URL)
+	assert.NoError(t, err)
+	defer res.Body.Close()
+
+	body, _ := io.ReadAll(res.Body)
+	assert.Equal(t, "terminated example.com", string(body))
+}
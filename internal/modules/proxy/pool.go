@@ -0,0 +1,257 @@
+package proxy
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"time"
+)
+
+const groupCookieMaxAge = 24 * time.Hour
+
+// BackendGroup is a named share of a pool's traffic, e.g. "stable" at 95
+// and "canary" at 5. Weights are relative, they do not need to sum to 100.
+type BackendGroup struct {
+	Name     string
+	Weight   int
+	Backends []Backend
+	balancer Balancer
+}
+
+// Pool is the set of backends a proxy or route balances over.
+type Pool struct {
+	Backends    []Backend
+	Groups      []*BackendGroup // empty when the proxy does not split traffic
+	GroupCookie string          // sticky group cookie name, empty disables it
+	Affinity    *Affinity       // sticky backend cookie, nil disables it
+	Outlier     *OutlierDetection
+	Retry       *RetryPolicy
+	Breaker     *CircuitBreaker
+	balancer    Balancer
+}
+
+// newPool splits backends into their weighted groups. Once a pool has a
+// group with weight and backends, ungrouped backends get no traffic.
+func newPool(backends []Backend, groups []BackendGroupModel, proxy ProxyModel) *Pool {
+	pool := &Pool{
+		Backends:    backends,
+		GroupCookie: proxy.GroupCookie,
+		Affinity:    newAffinity(proxy),
+		Outlier:     newOutlierDetection(proxy),
+		Retry:       newRetryPolicy(proxy),
+		Breaker:     newCircuitBreaker(proxy),
+		balancer:    newBalancer(proxy, backends),
+	}
+
+	for _, group := range groups {
+		if group.Weight <= 0 {
+			continue
+		}
+
+		obj := &BackendGroup{
+			Name:   group.Name,
+			Weight: group.Weight,
+		}
+		for _, backend := range backends {
+			if backend.GroupID == group.ID {
+				obj.Backends = append(obj.Backends, backend)
+			}
+		}
+		if len(obj.Backends) > 0 {
+			obj.balancer = newBalancer(proxy, obj.Backends)
+			pool.Groups = append(pool.Groups, obj)
+		}
+	}
+
+	return pool
+}
+
+// Next picks the backend for the request among those taking traffic, with
+// its pass through the backend's circuit. The returned cookie, when not
+// nil, must be sent to the client to pin it to the chosen group. r is nil
+// for layer-4 connections, which are never pinned and take no pass since
+// their outcome is not observed.
+func (p *Pool) Next(r *http.Request) (Backend, *breakerTicket, *http.Cookie, error) {
+	if len(p.Groups) == 0 {
+		if len(p.Backends) == 0 {
+			return Backend{}, nil, nil, ErrNoRouteFound
+		}
+		if backend, ticket, ok := p.pick(r, p.balancer, p.available(p.Backends)); ok {
+			return backend, ticket, nil, nil
+		}
+		return Backend{}, nil, nil, p.unavailable(p.Backends)
+	}
+
+	if group := p.stickyGroup(r); group != nil {
+		if backend, ticket, ok := p.pick(r, group.balancer, p.available(group.Backends)); ok {
+			return backend, ticket, nil, nil
+		}
+	}
+
+	group, backends := p.pickGroup()
+	if group == nil {
+		return Backend{}, nil, nil, p.unavailable(p.serving())
+	}
+	backend, ticket, ok := p.pick(r, group.balancer, backends)
+	if !ok {
+		return Backend{}, nil, nil, p.unavailable(p.serving())
+	}
+
+	var cookie *http.Cookie
+	if p.GroupCookie != "" && r != nil {
+		cookie = &http.Cookie{
+			Name:     p.GroupCookie,
+			Value:    group.Name,
+			Path:     "/",
+			MaxAge:   int(groupCookieMaxAge.Seconds()),
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		}
+	}
+
+	return backend, ticket, cookie, nil
+}
+
+// Lookup finds the backend with id among the backends currently taking
+// traffic, as long as it is healthy, not ejected and its circuit admits
+// the request.
+func (p *Pool) Lookup(id string) (Backend, *breakerTicket, bool) {
+	for _, backend := range p.serving() {
+		if backend.ID == id && isHealthy(backend) && !isEjected(backend) {
+			ticket, ok := p.Breaker.admit(backend)
+			return backend, ticket, ok
+		}
+	}
+	return Backend{}, nil, false
+}
+
+// NextExcluding picks a backend for another try of a request that failed
+// on the tried ones. Groups are ignored, any backend taking traffic will do.
+func (p *Pool) NextExcluding(r *http.Request, tried []Backend) (Backend, *breakerTicket, bool) {
+	candidates := slices.DeleteFunc(slices.Clone(p.available(p.serving())), func(backend Backend) bool {
+		return slices.ContainsFunc(tried, func(t Backend) bool { return t.ID == backend.ID })
+	})
+	return p.pick(r, p.balancer, candidates)
+}
+
+// pick balances r over backends and admits it through the chosen
+// backend's circuit, moving on to the others when that backend has no
+// probe slot left.
+func (p *Pool) pick(r *http.Request, balancer Balancer, backends []Backend) (Backend, *breakerTicket, bool) {
+	for len(backends) > 0 {
+		backend := balancer.Next(r, backends)
+		if r == nil {
+			return backend, nil, true
+		}
+		if ticket, ok := p.Breaker.admit(backend); ok {
+			return backend, ticket, true
+		}
+		backends = slices.DeleteFunc(slices.Clone(backends), func(b Backend) bool { return b.ID == backend.ID })
+	}
+	return Backend{}, nil, false
+}
+
+// serving lists the backends taking traffic, ignoring their health.
+func (p *Pool) serving() []Backend {
+	if len(p.Groups) == 0 {
+		return p.Backends
+	}
+
+	var backends []Backend
+	for _, group := range p.Groups {
+		backends = append(backends, group.Backends...)
+	}
+	return backends
+}
+
+func (p *Pool) stickyGroup(r *http.Request) *BackendGroup {
+	if p.GroupCookie == "" || r == nil {
+		return nil
+	}
+
+	cookie, err := r.Cookie(p.GroupCookie)
+	if err != nil {
+		return nil
+	}
+
+	for _, group := range p.Groups {
+		if group.Name == cookie.Value {
+			return group
+		}
+	}
+	return nil
+}
+
+// pickGroup picks a weighted group among those with healthy backends, and
+// returns it with those backends.
+func (p *Pool) pickGroup() (*BackendGroup, []Backend) {
+	total := 0
+	candidates := make([][]Backend, len(p.Groups))
+	for i, group := range p.Groups {
+		if candidates[i] = p.available(group.Backends); len(candidates[i]) > 0 {
+			total += group.Weight
+		}
+	}
+	if total == 0 {
+		return nil, nil
+	}
+
+	n := rand.IntN(total)
+	for i, group := range p.Groups {
+		if len(candidates[i]) == 0 {
+			continue
+		}
+		if n < group.Weight {
+			return group, candidates[i]
+		}
+		n -= group.Weight
+	}
+	return nil, nil
+}
+
+// available returns the backends that may take traffic: healthy ones whose
+// circuit lets requests through, minus those ejected as outliers as long as
+// that stays within the ejection cap. It is backends itself when nothing is
+// filtered out.
+func (p *Pool) available(backends []Backend) []Backend {
+	maxEjected := 0
+	if p.Outlier != nil {
+		maxEjected = len(backends) * p.Outlier.MaxEjectPercent / 100
+	}
+
+	var result []Backend
+	filtered, ejected := false, 0
+	for i, backend := range backends {
+		ok := isHealthy(backend) && p.Breaker.allows(backend)
+		if ok && p.Outlier != nil && ejected < maxEjected && isEjected(backend) {
+			ok = false
+			ejected++
+		}
+
+		if !ok && !filtered {
+			filtered = true
+			result = slices.Clone(backends[:i])
+		}
+		if ok && filtered {
+			result = append(result, backend)
+		}
+	}
+
+	if !filtered {
+		return backends
+	}
+	return result
+}
+
+// unavailable is the error for a pool where none of backends may take
+// traffic: a CircuitOpenError when circuits hold back healthy backends.
+func (p *Pool) unavailable(backends []Backend) error {
+	open := slices.ContainsFunc(backends, func(backend Backend) bool {
+		return isHealthy(backend) && !p.Breaker.allows(backend)
+	})
+	if open {
+		return p.Breaker.openError(backends)
+	}
+	return ErrNoHealthyBackend
+}
@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoolRoundRobin(t *testing.T) {
+	pool := newPool([]Backend{{ID: "a", Host: "a"}, {ID: "b", Host: "b"}}, nil, ProxyModel{})
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	var hosts []string
+	for range 4 {
+		backend, _, cookie, err := pool.Next(r)
+		assert.NoError(t, err)
+		assert.Nil(t, cookie)
+		hosts = append(hosts, backend.Host)
+	}
+	assert.Equal(t, []string{"a", "b", "a", "b"}, hosts)
+}
+
+func TestPoolSmoothWeightedRoundRobin(t *testing.T) {
+	pool := newPool([]Backend{{ID: "a", Host: "a", Weight: 5}, {ID: "b", Host: "b", Weight: 1}, {ID: "c", Host: "c", Weight: 1}}, nil, ProxyModel{})
+
+	var hosts []string
+	for range 7 {
+		backend, _, _, err := pool.Next(nil)
+		assert.NoError(t, err)
+		hosts = append(hosts, backend.Host)
+	}
+	assert.Equal(t, []string{"a", "a", "b", "a", "c", "a", "a"}, hosts)
+}
+
+func TestPoolWeightedGroups(t *testing.T) {
+	backends := []Backend{
+		{Host: "stable-1", GroupID: "g-stable"},
+		{Host: "canary-1", GroupID: "g-canary"},
+		{Host: "ungrouped"},
+	}
+	groups := []BackendGroupModel{
+		{ID: "g-stable", Name: "stable", Weight: 95},
+		{ID: "g-canary", Name: "canary", Weight: 5},
+		{ID: "g-empty", Name: "empty", Weight: 50},
+	}
+	pool := newPool(backends, groups, ProxyModel{})
+	assert.Len(t, pool.Groups, 2)
+
+	counts := map[string]int{}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for range 10000 {
+		backend, _, _, err := pool.Next(r)
+		assert.NoError(t, err)
+		counts[backend.Host]++
+	}
+	assert.Zero(t, counts["ungrouped"])
+	assert.InDelta(t, 500, counts["canary-1"], 150)
+	assert.InDelta(t, 9500, counts["stable-1"], 150)
+}
+
+func TestPoolStickyGroupCookie(t *testing.T) {
+	backends := []Backend{
+		{Host: "stable-1", GroupID: "g-stable"},
+		{Host: "canary-1", GroupID: "g-canary"},
+	}
+	groups := []BackendGroupModel{
+		{ID: "g-stable", Name: "stable", Weight: 1},
+		{ID: "g-canary", Name: "canary", Weight: 1},
+	}
+	pool := newPool(backends, groups, ProxyModel{GroupCookie: "rp_group"})
+
+	backend, _, cookie, err := pool.Next(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NoError(t, err)
+	assert.NotNil(t, cookie)
+	assert.Equal(t, "rp_group", cookie.Name)
+
+	for range 20 {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+		next, _, nextCookie, err := pool.Next(r)
+		assert.NoError(t, err)
+		assert.Nil(t, nextCookie)
+		assert.Equal(t, backend.Host, next.Host)
+	}
+}
@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Redirect answers a host or route with a redirect instead of proxying.
+// Destination may use the $host, $path and $query placeholders.
+type Redirect struct {
+	Status        int
+	Destination   string
+	PreserveQuery bool
+}
+
+func newRedirect(destination string, status int, preserveQuery bool) *Redirect {
+	if destination == "" {
+		return nil
+	}
+
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		status = http.StatusFound
+	}
+
+	return &Redirect{
+		Status:        status,
+		Destination:   destination,
+		PreserveQuery: preserveQuery,
+	}
+}
+
+// Location expands the destination template for the request. When the
+// query is preserved but the template has no $query, it is appended.
+func (rd *Redirect) Location(r *http.Request) string {
+	query := ""
+	if rd.PreserveQuery {
+		query = r.URL.RawQuery
+	}
+
+	location := strings.NewReplacer(
+		"$host", r.Host,
+		"$path", r.URL.EscapedPath(),
+		"$query", query,
+	).Replace(rd.Destination)
+
+	if query != "" && !strings.Contains(rd.Destination, "$query") {
+		separator := "?"
+		if strings.Contains(location, "?") {
+			separator = "&"
+		}
+		location += separator + query
+	}
+
+	return location
+}
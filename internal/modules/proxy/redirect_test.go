@@ -0,0 +1,28 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedirectLocation(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "http://example.com/docs/a%20b?ref=x", nil)
+
+	apex := newRedirect("https://www.$host$path", http.StatusMovedPermanently, true)
+	assert.Equal(t, "https://www.example.com/docs/a%20b?ref=x", apex.Location(r))
+
+	dropped := newRedirect("https://new.example.org$path", http.StatusPermanentRedirect, false)
+	assert.Equal(t, "https://new.example.org/docs/a%20b", dropped.Location(r))
+
+	merged := newRedirect("https://example.org/landing?utm=short", 0, true)
+	assert.Equal(t, http.StatusFound, merged.Status)
+	assert.Equal(t, "https://example.org/landing?utm=short&ref=x", merged.Location(r))
+
+	explicit := newRedirect("https://example.org$path?from=$host&$query", http.StatusTemporaryRedirect, true)
+	assert.Equal(t, "https://example.org/docs/a%20b?from=example.com&ref=x", explicit.Location(r))
+
+	assert.Nil(t, newRedirect("", http.StatusMovedPermanently, true))
+}
@@ -1,13 +1,22 @@
 package proxy
 
 import (
+	"log"
+	"regexp"
+	"slices"
 	"strings"
 
 	"gorm.io/gorm"
 )
 
 type Repository interface {
-	GetTargetConfig(domain string) (*TargetConfig, error)
+	FindHostID(domain string) (string, error)
+	GetHostConfig(hostID string) (*TargetConfig, error)
+	GetTCPTargetConfig(proxyID string) (*TargetConfig, error)
+	ListTCPProxies() ([]ProxyModel, error)
+	ListHealthCheckTargets() ([]HealthCheckTarget, error)
+	ListBackendIDs() ([]string, error)
+	ListProxyIDs() ([]string, error)
 }
 
 type repository struct {
@@ -20,41 +29,105 @@ func NewRepository(db *gorm.DB) Repository {
 	}
 }
 
-func (r *repository) GetTargetConfig(domain string) (*TargetConfig, error) {
+// FindHostID returns the ID of the stored host serving domain: the exact
+// host, or else its most specific wildcard.
+func (r *repository) FindHostID(domain string) (string, error) {
+	candidates := hostCandidates(strings.ToLower(domain))
 
-	incomingHost := strings.ToLower(domain)
+	var hosts []HostModel
+	if err := r.db.Where("host IN ?", candidates).Find(&hosts).Error; err != nil {
+		return "", err
+	}
 
+	host, ok := mostSpecificHost(hosts, candidates)
+	if !ok {
+		return "", gorm.ErrRecordNotFound
+	}
+	return host.ID, nil
+}
+
+// GetHostConfig loads the config of a stored host, shared by every domain
+// the host serves.
+func (r *repository) GetHostConfig(hostID string) (*TargetConfig, error) {
 	var host HostModel
+	if err := r.db.Where("id = ?", hostID).First(&host).Error; err != nil {
+		return nil, err
+	}
 
-	if strings.Contains(incomingHost, "*") {
-		incomingHost = strings.ReplaceAll(incomingHost, "*", "%")
-		if err := r.db.Where("host LIKE ?", incomingHost).First(&host).Error; err != nil {
-			return nil, err
-		}
-	} else {
-		if err := r.db.Where("host = ?", incomingHost).First(&host).Error; err != nil {
-			return nil, err
-		}
+	// redirect hosts answer every request themselves, no proxy needed
+	if redirect := newRedirect(host.RedirectURL, host.RedirectStatus, host.RedirectPreserveQuery); redirect != nil {
+		return &TargetConfig{
+			Headers:    map[string]string{},
+			ForceHTTPS: host.ForceHTTPS,
+			Redirect:   redirect,
+		}, nil
 	}
 
-	// if host not found, return nil
-	if host.ID == "" {
-		return nil, gorm.ErrRecordNotFound
+	var proxy ProxyModel
+	if err := r.db.Where("id = ?", host.ProxyID).First(&proxy).Error; err != nil {
+		return nil, err
+	}
+
+	var routes []RouteModel
+	if err := r.db.Where("host_id = ?", host.ID).Find(&routes).Error; err != nil {
+		return nil, err
+	}
+
+	routeIDs := make([]string, 0, len(routes))
+	for _, route := range routes {
+		routeIDs = append(routeIDs, route.ID)
 	}
 
 	var backends []BackendModel
 	var headers []HeadersModel
-	errChan := make(chan error, 2)
+	var routeBackends []BackendModel
+	var routeHeaders []HeadersModel
+	var routeMatchers []RouteMatcherModel
+	var groups []BackendGroupModel
+	var mirrors []MirrorModel
+	errChan := make(chan error, 7)
 
 	go func() {
-		errChan <- r.db.Where("proxy_id = ?", host.ProxyID).Where("enabled = ?", true).Find(&backends).Error
+		errChan <- r.db.Where("proxy_id = ?", host.ProxyID).Where("route_id IS NULL").Where("enabled = ?", true).Find(&backends).Error
 	}()
 
 	go func() {
-		errChan <- r.db.Where("proxy_id = ?", host.ProxyID).Find(&headers).Error
+		errChan <- r.db.Where("proxy_id = ?", host.ProxyID).Where("route_id IS NULL").Find(&headers).Error
 	}()
 
-	for range 2 {
+	go func() {
+		if len(routeIDs) == 0 {
+			errChan <- nil
+			return
+		}
+		errChan <- r.db.Where("route_id IN ?", routeIDs).Where("enabled = ?", true).Find(&routeBackends).Error
+	}()
+
+	go func() {
+		if len(routeIDs) == 0 {
+			errChan <- nil
+			return
+		}
+		errChan <- r.db.Where("route_id IN ?", routeIDs).Find(&routeHeaders).Error
+	}()
+
+	go func() {
+		if len(routeIDs) == 0 {
+			errChan <- nil
+			return
+		}
+		errChan <- r.db.Where("route_id IN ?", routeIDs).Find(&routeMatchers).Error
+	}()
+
+	go func() {
+		errChan <- r.db.Where("proxy_id = ?", host.ProxyID).Find(&groups).Error
+	}()
+
+	go func() {
+		errChan <- r.db.Where("proxy_id = ?", host.ProxyID).Where("enabled = ?", true).Find(&mirrors).Error
+	}()
+
+	for range 7 {
 		if err := <-errChan; err != nil {
 			return nil, err
 		}
@@ -62,11 +135,7 @@ func (r *repository) GetTargetConfig(domain string) (*TargetConfig, error) {
 
 	backendsObj := []Backend{}
 	for _, backend := range backends {
-		backendsObj = append(backendsObj, Backend{
-			Scheme: backend.Scheme,
-			Host:   backend.Host,
-			Port:   backend.Port,
-		})
+		backendsObj = append(backendsObj, toBackend(backend))
 	}
 
 	headersMap := make(map[string]string)
@@ -74,9 +143,314 @@ func (r *repository) GetTargetConfig(domain string) (*TargetConfig, error) {
 		headersMap[header.Key] = header.Value
 	}
 
+	routesByID := make(map[string]*Route, len(routes))
+	routesObj := make([]*Route, 0, len(routes))
+	invalidRoutes := make(map[*Route]bool)
+	for _, route := range routes {
+		obj := &Route{
+			Path:     route.Path,
+			Exact:    route.Exact,
+			Priority: route.Priority,
+			Methods:  parseMethods(route.Methods),
+			Headers:  make(map[string]string, len(headersMap)),
+		}
+		// route headers override the proxy-wide ones
+		for key, val := range headersMap {
+			obj.Headers[key] = val
+		}
+
+		rewrite, err := toRewrite(route)
+		if err != nil {
+			log.Printf("Invalid rewrite regex %q on route %s: %v", route.RewriteRegex, route.ID, err)
+			invalidRoutes[obj] = true
+		}
+		obj.Rewrite = rewrite
+		obj.Redirect = newRedirect(route.RedirectURL, route.RedirectStatus, route.RedirectPreserveQuery)
+
+		routesByID[route.ID] = obj
+		routesObj = append(routesObj, obj)
+	}
+
+	routeBackendsByID := make(map[string][]Backend, len(routes))
+	for _, backend := range routeBackends {
+		routeBackendsByID[*backend.RouteID] = append(routeBackendsByID[*backend.RouteID], toBackend(backend))
+	}
+
+	for _, header := range routeHeaders {
+		if route, ok := routesByID[*header.RouteID]; ok {
+			route.Headers[header.Key] = header.Value
+		}
+	}
+
+	for _, matcher := range routeMatchers {
+		route, ok := routesByID[matcher.RouteID]
+		if !ok {
+			continue
+		}
+
+		obj := Matcher{
+			Type:  matcher.Type,
+			Name:  matcher.Name,
+			Value: matcher.Value,
+		}
+		if matcher.Regex {
+			re, err := regexp.Compile(matcher.Value)
+			if err != nil {
+				// a broken rule must not widen the route, so drop the route entirely
+				log.Printf("Invalid regex %q on route matcher %s: %v", matcher.Value, matcher.ID, err)
+				invalidRoutes[route] = true
+				continue
+			}
+			obj.Regex = re
+		}
+		route.Matchers = append(route.Matchers, obj)
+	}
+
+	routesObj = slices.DeleteFunc(routesObj, func(route *Route) bool {
+		return invalidRoutes[route]
+	})
+
+	pool := newPool(backendsObj, groups, proxy)
+
+	// routes without their own backends fall back to the proxy backends
+	for id, route := range routesByID {
+		route.Pool = pool
+		if routeBackends := routeBackendsByID[id]; len(routeBackends) > 0 {
+			route.Pool = newPool(routeBackends, groups, proxy)
+		}
+	}
+
+	sortRoutes(routesObj)
+
+	mirrorsObj := make([]Mirror, 0, len(mirrors))
+	for _, mirror := range mirrors {
+		if mirror.SamplePercent <= 0 {
+			continue
+		}
+		mirrorsObj = append(mirrorsObj, Mirror{
+			Backend: Backend{
+				Scheme: mirror.Scheme,
+				Host:   mirror.Host,
+				Port:   mirror.Port,
+			},
+			SamplePercent: mirror.SamplePercent,
+		})
+	}
+
+	mirrorBodyLimit := proxy.MirrorBodyLimit
+	if mirrorBodyLimit <= 0 {
+		mirrorBodyLimit = DefaultMirrorBodyLimit
+	}
+
+	return &TargetConfig{
+		Pool:            pool,
+		Headers:         headersMap,
+		ForceHTTPS:      host.ForceHTTPS,
+		TLSPassthrough:  host.TLSPassthrough,
+		Routes:          routesObj,
+		HostHeaderMode:  proxy.HostHeaderMode,
+		HostHeaderValue: proxy.HostHeaderValue,
+		Mirrors:         mirrorsObj,
+		MirrorBodyLimit: mirrorBodyLimit,
+	}, nil
+}
+
+func (r *repository) GetTCPTargetConfig(proxyID string) (*TargetConfig, error) {
+	var proxy ProxyModel
+	if err := r.db.Where("id = ?", proxyID).Where("listen_port IS NOT NULL").First(&proxy).Error; err != nil {
+		return nil, err
+	}
+
+	var backends []BackendModel
+	var groups []BackendGroupModel
+	errChan := make(chan error, 2)
+
+	go func() {
+		errChan <- r.db.Where("proxy_id = ?", proxyID).Where("route_id IS NULL").Where("enabled = ?", true).Find(&backends).Error
+	}()
+
+	go func() {
+		errChan <- r.db.Where("proxy_id = ?", proxyID).Find(&groups).Error
+	}()
+
+	for range 2 {
+		if err := <-errChan; err != nil {
+			return nil, err
+		}
+	}
+
+	backendsObj := []Backend{}
+	for _, backend := range backends {
+		backendsObj = append(backendsObj, toBackend(backend))
+	}
+
 	return &TargetConfig{
-		Backends:   backendsObj,
-		Headers:    headersMap,
-		ForceHTTPS: host.ForceHTTPS,
+		Pool:    newPool(backendsObj, groups, proxy),
+		Headers: map[string]string{},
 	}, nil
 }
+
+func (r *repository) ListTCPProxies() ([]ProxyModel, error) {
+	var proxies []ProxyModel
+	if err := r.db.Where("listen_port IS NOT NULL").Find(&proxies).Error; err != nil {
+		return nil, err
+	}
+	return proxies, nil
+}
+
+func (r *repository) ListHealthCheckTargets() ([]HealthCheckTarget, error) {
+	var proxies []ProxyModel
+	if err := r.db.Where("health_check_path <> ?", "").Find(&proxies).Error; err != nil {
+		return nil, err
+	}
+	if len(proxies) == 0 {
+		return nil, nil
+	}
+
+	checks := make(map[string]HealthCheck, len(proxies))
+	proxyIDs := make([]string, 0, len(proxies))
+	for _, proxy := range proxies {
+		checks[proxy.ID] = newHealthCheck(proxy)
+		proxyIDs = append(proxyIDs, proxy.ID)
+	}
+
+	// route backends belong to their proxy through the route's host
+	var routes []struct {
+		ID      string
+		ProxyID string
+	}
+	if err := r.db.Model(&RouteModel{}).
+		Select("routes.id AS id, hosts.proxy_id AS proxy_id").
+		Joins("JOIN hosts ON hosts.id = routes.host_id").
+		Where("hosts.proxy_id IN ?", proxyIDs).
+		Scan(&routes).Error; err != nil {
+		return nil, err
+	}
+
+	routeProxy := make(map[string]string, len(routes))
+	routeIDs := make([]string, 0, len(routes))
+	for _, route := range routes {
+		routeProxy[route.ID] = route.ProxyID
+		routeIDs = append(routeIDs, route.ID)
+	}
+
+	query := r.db.Where("enabled = ?", true)
+	if len(routeIDs) > 0 {
+		query = query.Where("proxy_id IN ? OR route_id IN ?", proxyIDs, routeIDs)
+	} else {
+		query = query.Where("proxy_id IN ?", proxyIDs)
+	}
+
+	var backends []BackendModel
+	if err := query.Find(&backends).Error; err != nil {
+		return nil, err
+	}
+
+	targets := make([]HealthCheckTarget, 0, len(backends))
+	for _, backend := range backends {
+		proxyID := backend.ProxyID
+		if backend.RouteID != nil {
+			if id, ok := routeProxy[*backend.RouteID]; ok {
+				proxyID = id
+			}
+		}
+		check, ok := checks[proxyID]
+		if !ok {
+			continue
+		}
+		targets = append(targets, HealthCheckTarget{Check: check, Backend: toBackend(backend)})
+	}
+	return targets, nil
+}
+
+// ListBackendIDs lists every stored backend, enabled or not.
+func (r *repository) ListBackendIDs() ([]string, error) {
+	var ids []string
+	if err := r.db.Model(&BackendModel{}).Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// ListProxyIDs lists every stored proxy, enabled or not.
+func (r *repository) ListProxyIDs() ([]string, error) {
+	var ids []string
+	if err := r.db.Model(&ProxyModel{}).Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func toRewrite(route RouteModel) (*Rewrite, error) {
+	if route.StripPrefix == "" && route.AddPrefix == "" && route.RewriteRegex == "" {
+		return nil, nil
+	}
+
+	rewrite := &Rewrite{
+		StripPrefix: route.StripPrefix,
+		AddPrefix:   route.AddPrefix,
+		Replacement: route.RewriteReplacement,
+	}
+	if route.RewriteRegex != "" {
+		re, err := regexp.Compile(route.RewriteRegex)
+		if err != nil {
+			return nil, err
+		}
+		rewrite.Regex = re
+	}
+	return rewrite, nil
+}
+
+func toBackend(backend BackendModel) Backend {
+	obj := Backend{
+		ID:     backend.ID,
+		Scheme: backend.Scheme,
+		Host:   backend.Host,
+		Port:   backend.Port,
+		Path:   backend.Path,
+		Query:  strings.TrimPrefix(backend.Query, "?"),
+		Weight: backend.Weight,
+
+		ProxyProtocol: backend.ProxyProtocol,
+	}
+	if backend.GroupID != nil {
+		obj.GroupID = *backend.GroupID
+	}
+
+	if backend.Scheme == SchemeFile {
+		obj.SPAFallback = backend.SPAFallback
+		for _, index := range strings.Split(backend.IndexFiles, ",") {
+			if index = strings.TrimSpace(index); index != "" {
+				obj.IndexFiles = append(obj.IndexFiles, index)
+			}
+		}
+		if len(obj.IndexFiles) == 0 {
+			obj.IndexFiles = []string{"index.html"}
+		}
+	}
+
+	return obj
+}
+
+// hostCandidates lists the stored host values that may serve domain, from
+// most to least specific: the exact host first, then every wildcard parent
+// (a.b.example.com -> *.b.example.com, *.example.com, *.com).
+func hostCandidates(domain string) []string {
+	candidates := []string{domain}
+	labels := strings.Split(domain, ".")
+	for i := 1; i < len(labels); i++ {
+		candidates = append(candidates, "*."+strings.Join(labels[i:], "."))
+	}
+	return candidates
+}
+
+func mostSpecificHost(hosts []HostModel, candidates []string) (HostModel, bool) {
+	for _, candidate := range candidates {
+		for _, host := range hosts {
+			if host.Host == candidate {
+				return host, true
+			}
+		}
+	}
+	return HostModel{}, false
+}
@@ -0,0 +1,36 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostCandidates(t *testing.T) {
+	assert.Equal(t, []string{
+		"a.b.example.com",
+		"*.b.example.com",
+		"*.example.com",
+		"*.com",
+	}, hostCandidates("a.b.example.com"))
+}
+
+func TestMostSpecificHost(t *testing.T) {
+	candidates := hostCandidates("shop.acme.example.com")
+	hosts := []HostModel{
+		{ID: "wide", Host: "*.example.com"},
+		{ID: "narrow", Host: "*.acme.example.com"},
+	}
+
+	host, ok := mostSpecificHost(hosts, candidates)
+	assert.True(t, ok)
+	assert.Equal(t, "narrow", host.ID)
+
+	hosts = append(hosts, HostModel{ID: "exact", Host: "shop.acme.example.com"})
+	host, ok = mostSpecificHost(hosts, candidates)
+	assert.True(t, ok)
+	assert.Equal(t, "exact", host.ID)
+
+	_, ok = mostSpecificHost(nil, candidates)
+	assert.False(t, ok)
+}
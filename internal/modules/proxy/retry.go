@@ -0,0 +1,266 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// the retry budget is counted over tumbling windows of this length
+	retryBudgetWindow = 10 * time.Second
+	// retries always allowed per window, so quiet proxies can retry too
+	retryBudgetMinRetries = 10
+	// request bodies up to this size are buffered so they can be replayed
+	retryBodyLimit = 64 << 10 // 64 KiB
+)
+
+var (
+	errTryTimeout      = errors.New("upstream did not respond within the per-try timeout")
+	errRetryBodyClosed = errors.New("request body of an abandoned try")
+	errRetryBodyLost   = errors.New("request body was sent to another backend and not buffered")
+)
+
+// RetryPolicy retries requests on another backend when the upstream fails
+// before sending a response, e.g. a refused dial during a rolling deploy.
+type RetryPolicy struct {
+	Attempts      int           // retries after the first try
+	PerTryTimeout time.Duration // time allowed until response headers, zero disables it
+	NonIdempotent bool          // also retry POST, PATCH and similar
+	budget        *retryBudget
+}
+
+func newRetryPolicy(proxy ProxyModel) *RetryPolicy {
+	if proxy.RetryAttempts <= 0 {
+		return nil
+	}
+
+	return &RetryPolicy{
+		Attempts:      proxy.RetryAttempts,
+		PerTryTimeout: time.Duration(proxy.RetryPerTryTimeoutMs) * time.Millisecond,
+		NonIdempotent: proxy.RetryNonIdempotent,
+		budget:        retryBudgetFor(proxy.ID, proxy.RetryBudgetPercent),
+	}
+}
+
+// tryTimeout is the per-try timeout, zero when p is nil or has none.
+func (p *RetryPolicy) tryTimeout() time.Duration {
+	if p == nil {
+		return 0
+	}
+	return p.PerTryTimeout
+}
+
+// canRetry reports whether the request may be sent again after err, the
+// attempt-th try, failed.
+func (p *RetryPolicy) canRetry(r *http.Request, body *retryBody, attempt int, err error) bool {
+	if p == nil || attempt > p.Attempts {
+		return false
+	}
+	// the client went away or ran out of time, nobody waits for a retry
+	if r.Context().Err() != nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if !p.NonIdempotent && !isIdempotent(r.Method) {
+		return false
+	}
+	// a body larger than the buffer cannot be replayed
+	if body != nil && !body.replayable() {
+		return false
+	}
+	return p.budget.allow()
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// retryBudget caps retries at a share of a proxy's requests, so a failing
+// cluster is not hammered with extra load.
+type retryBudget struct {
+	percent int
+
+	mu       sync.Mutex
+	start    time.Time
+	requests int
+	retries  int
+}
+
+// retryBudgets keeps one budget per proxy ID, shared by all its routes
+// and kept across config reloads. StatePruner drops removed proxies.
+var retryBudgets sync.Map // map[string]*retryBudget
+
+func retryBudgetFor(proxyID string, percent int) *retryBudget {
+	budget, _ := retryBudgets.LoadOrStore(proxyID, &retryBudget{})
+	b := budget.(*retryBudget)
+
+	b.mu.Lock()
+	b.percent = max(percent, 0)
+	b.mu.Unlock()
+	return b
+}
+
+func (b *retryBudget) rotate(now time.Time) {
+	if now.Sub(b.start) >= retryBudgetWindow {
+		b.start, b.requests, b.retries = now, 0, 0
+	}
+}
+
+// request counts a client request towards the budget.
+func (b *retryBudget) request() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rotate(time.Now())
+	b.requests++
+}
+
+// allow takes a retry from the budget when one is left.
+func (b *retryBudget) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rotate(time.Now())
+	if b.retries >= retryBudgetMinRetries+b.requests*b.percent/100 {
+		return false
+	}
+	b.retries++
+	return true
+}
+
+// retryBody keeps the first retryBodyLimit bytes read from a request body,
+// so a try that failed after sending no more than that can be replayed on
+// another backend. Every try reads through its own reader.
+type retryBody struct {
+	body io.ReadCloser
+
+	mu       sync.Mutex
+	buf      []byte
+	read     int // bytes read from body
+	overflow bool
+}
+
+func newRetryBody(body io.ReadCloser) *retryBody {
+	return &retryBody{body: body}
+}
+
+// reader starts a try, replaying what earlier tries read first.
+func (b *retryBody) reader() io.ReadCloser {
+	return &retryBodyReader{body: b}
+}
+
+// replayable reports whether every byte read so far is buffered.
+func (b *retryBody) replayable() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.overflow
+}
+
+// retryBodyReader is the body of one try. Close is left to the server,
+// since the transport closes the body of every failed request; it only
+// stops the try from reading on.
+type retryBodyReader struct {
+	body   *retryBody
+	pos    int
+	closed bool
+}
+
+func (r *retryBodyReader) Read(p []byte) (int, error) {
+	b := r.body
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if r.closed {
+		return 0, errRetryBodyClosed
+	}
+	if r.pos < len(b.buf) {
+		n := copy(p, b.buf[r.pos:])
+		r.pos += n
+		return n, nil
+	}
+	if r.pos != b.read {
+		return 0, errRetryBodyLost
+	}
+
+	n, err := b.body.Read(p)
+	b.read += n
+	r.pos += n
+	if !b.overflow {
+		if len(b.buf)+n > retryBodyLimit {
+			b.overflow, b.buf = true, nil
+		} else {
+			b.buf = append(b.buf, p[:n]...)
+		}
+	}
+	return n, err
+}
+
+func (r *retryBodyReader) Close() error {
+	r.body.mu.Lock()
+	defer r.body.mu.Unlock()
+
+	r.closed = true
+	return nil
+}
+
+// tryTimeoutTransport fails a round trip whose response headers take
+// longer than timeout. The response body may take as long as it needs.
+type tryTimeoutTransport struct {
+	http.RoundTripper
+	timeout time.Duration
+}
+
+func withTryTimeout(rt http.RoundTripper, timeout time.Duration) http.RoundTripper {
+	if timeout <= 0 {
+		return rt
+	}
+	return &tryTimeoutTransport{RoundTripper: rt, timeout: timeout}
+}
+
+func (t *tryTimeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	timer := time.AfterFunc(t.timeout, cancel)
+
+	res, err := t.RoundTripper.RoundTrip(req.WithContext(ctx))
+	if !timer.Stop() {
+		// the timer fired: whatever happened, the try took too long
+		if err == nil {
+			res.Body.Close()
+		}
+		cancel()
+		return nil, errTryTimeout
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// upgraded connections need the writable body as is; their context
+	// is released with the client request
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		res.Body = &cancelOnClose{ReadCloser: res.Body, cancel: cancel}
+	}
+	return res, nil
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
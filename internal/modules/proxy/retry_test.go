@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// deadBackend returns a backend whose port refuses connections.
+func deadBackend(t *testing.T, id string) Backend {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := ln.Addr().(*net.TCPAddr)
+	ln.Close()
+	return Backend{ID: id, Scheme: "http", Host: addr.IP.String(), Port: addr.Port}
+}
+
+func retryTarget(backends []Backend, proxy ProxyModel) *SelectedTarget {
+	pool := newPool(backends, nil, proxy)
+	return &SelectedTarget{
+		Backend: backends[0],
+		Headers: map[string]string{},
+		Pool:    pool,
+		Retry:   pool.Retry,
+	}
+}
+
+func TestRetryOnAnotherBackend(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte("ok " + string(body)))
+	}))
+	defer upstream.Close()
+
+	live := backendFor(t, upstream)
+	live.ID = "retry-live"
+	target := retryTarget([]Backend{deadBackend(t, "retry-dead"), live}, ProxyModel{ID: "retry-proxy", RetryAttempts: 1})
+	handler := NewHandler(&stubService{target: target})
+
+	w := httptest.NewRecorder()
+	handler.HandleRequest(w, httptest.NewRequest(http.MethodPut, "/", strings.NewReader("payload")))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok payload", w.Body.String())
+
+	// POST is not idempotent and is not retried by default
+	w = httptest.NewRecorder()
+	handler.HandleRequest(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("payload")))
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+}
+
+func TestRetryReplaysReadBody(t *testing.T) {
+	// reads the whole body, then drops the connection without answering
+	dropping := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}))
+	defer dropping.Close()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte("ok " + strconv.Itoa(len(body))))
+	}))
+	defer upstream.Close()
+
+	first, live := backendFor(t, dropping), backendFor(t, upstream)
+	first.ID, live.ID = "retry-dropping", "retry-replay-live"
+	target := retryTarget([]Backend{first, live}, ProxyModel{ID: "retry-proxy-3", RetryAttempts: 1})
+	handler := NewHandler(&stubService{target: target})
+
+	body := strings.Repeat("x", retryBodyLimit)
+	w := httptest.NewRecorder()
+	handler.HandleRequest(w, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(body)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok "+strconv.Itoa(len(body)), w.Body.String())
+
+	// larger bodies are not buffered and cannot be sent again
+	w = httptest.NewRecorder()
+	handler.HandleRequest(w, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(body+"x")))
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+}
+
+func TestRetryGivesUpAfterAttempts(t *testing.T) {
+	backends := []Backend{deadBackend(t, "retry-dead-1"), deadBackend(t, "retry-dead-2"), deadBackend(t, "retry-dead-3")}
+	target := retryTarget(backends, ProxyModel{ID: "retry-proxy-2", RetryAttempts: 1})
+
+	w := httptest.NewRecorder()
+	NewHandler(&stubService{target: target}).HandleRequest(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Equal(t, "Destination unreachable", w.Body.String())
+}
+
+func TestRetryBudget(t *testing.T) {
+	budget := &retryBudget{percent: 10}
+	for range 100 {
+		budget.request()
+	}
+
+	allowed := 0
+	for range 100 {
+		if budget.allow() {
+			allowed++
+		}
+	}
+	assert.Equal(t, retryBudgetMinRetries+10, allowed)
+}
+
+func TestTryTimeout(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.Write([]byte("done"))
+	}))
+	defer upstream.Close()
+
+	rt := withTryTimeout(http.DefaultTransport, 50*time.Millisecond)
+
+	req, _ := http.NewRequest(http.MethodGet, upstream.URL+"/slow", nil)
+	_, err := rt.RoundTrip(req)
+	assert.ErrorIs(t, err, errTryTimeout)
+
+	req, _ = http.NewRequest(http.MethodGet, upstream.URL+"/fast", nil)
+	res, err := rt.RoundTrip(req)
+	assert.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "done", string(body))
+}
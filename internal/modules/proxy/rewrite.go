@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Rewrite changes the upstream request path of a route. The steps run in
+// order: strip StripPrefix at a segment boundary, replace Regex matches with Replacement ($1,
+// ${name} expand capture groups), then prepend AddPrefix. Every step works
+// on the escaped path so encoded characters such as %2F survive.
+type Rewrite struct {
+	StripPrefix string
+	AddPrefix   string
+	Regex       *regexp.Regexp
+	Replacement string
+}
+
+func (rw *Rewrite) Apply(u *url.URL) {
+	escaped := u.EscapedPath()
+
+	if rw.StripPrefix != "" {
+		escaped = cutPathPrefix(escaped, escapePath(rw.StripPrefix))
+	}
+
+	if rw.Regex != nil {
+		escaped = rw.Regex.ReplaceAllString(escaped, rw.Replacement)
+	}
+
+	if rw.AddPrefix != "" {
+		escaped = strings.TrimSuffix(escapePath(rw.AddPrefix), "/") + ensureLeadingSlash(escaped)
+	}
+
+	escaped = ensureLeadingSlash(escaped)
+
+	path, err := url.PathUnescape(escaped)
+	if err != nil {
+		return
+	}
+
+	u.Path = path
+	u.RawPath = ""
+	if u.EscapedPath() != escaped {
+		u.RawPath = escaped
+	}
+}
+
+// cutPathPrefix removes prefix from path when it ends at a segment
+// boundary, so /api strips /api and /api/x but not /apiv2/x.
+func cutPathPrefix(path, prefix string) string {
+	prefix = strings.TrimSuffix(prefix, "/")
+	rest, ok := strings.CutPrefix(path, prefix)
+	if !ok || (rest != "" && !strings.HasPrefix(rest, "/")) {
+		return path
+	}
+	return rest
+}
+
+func escapePath(path string) string {
+	return (&url.URL{Path: path}).EscapedPath()
+}
+
+func ensureLeadingSlash(path string) string {
+	if !strings.HasPrefix(path, "/") {
+		return "/" + path
+	}
+	return path
+}
+
+// joinBackendPath mounts u under the backend base path and prepends the
+// backend fixed query, the same way httputil.NewSingleHostReverseProxy
+// joins its target URL.
+func joinBackendPath(u *url.URL, backend Backend) {
+	if backend.Path != "" {
+		u.Path, u.RawPath = joinURLPath(&url.URL{Path: backend.Path}, u)
+	}
+
+	if backend.Query == "" || u.RawQuery == "" {
+		u.RawQuery = backend.Query + u.RawQuery
+	} else {
+		u.RawQuery = backend.Query + "&" + u.RawQuery
+	}
+}
+
+// joinURLPath and singleJoiningSlash are copied from net/http/httputil.
+func joinURLPath(a, b *url.URL) (path, rawpath string) {
+	if a.RawPath == "" && b.RawPath == "" {
+		return singleJoiningSlash(a.Path, b.Path), ""
+	}
+	// Same as singleJoiningSlash, but uses EscapedPath to determine
+	// whether a slash should be added
+	apath := a.EscapedPath()
+	bpath := b.EscapedPath()
+
+	aslash := strings.HasSuffix(apath, "/")
+	bslash := strings.HasPrefix(bpath, "/")
+
+	switch {
+	case aslash && bslash:
+		return a.Path + b.Path[1:], apath + bpath[1:]
+	case !aslash && !bslash:
+		return a.Path + "/" + b.Path, apath + "/" + bpath
+	}
+	return a.Path + b.Path, apath + bpath
+}
+
+func singleJoiningSlash(a, b string) string {
+	aslash := strings.HasSuffix(a, "/")
+	bslash := strings.HasPrefix(b, "/")
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
+}
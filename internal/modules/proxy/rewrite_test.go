@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewriteApply(t *testing.T) {
+	tests := []struct {
+		name        string
+		rewrite     Rewrite
+		target      string
+		wantPath    string
+		wantRawPath string
+	}{
+		{
+			name:     "strip prefix",
+			rewrite:  Rewrite{StripPrefix: "/service-x"},
+			target:   "/service-x/users/1",
+			wantPath: "/users/1",
+		},
+		{
+			name:     "strip whole path",
+			rewrite:  Rewrite{StripPrefix: "/service-x"},
+			target:   "/service-x",
+			wantPath: "/",
+		},
+		{
+			name:     "strip prefix with trailing slash",
+			rewrite:  Rewrite{StripPrefix: "/api/"},
+			target:   "/api/users",
+			wantPath: "/users",
+		},
+		{
+			name:     "strip prefix only at segment boundary",
+			rewrite:  Rewrite{StripPrefix: "/api"},
+			target:   "/apiv2/x",
+			wantPath: "/apiv2/x",
+		},
+		{
+			name:     "add prefix",
+			rewrite:  Rewrite{AddPrefix: "/v2/"},
+			target:   "/users",
+			wantPath: "/v2/users",
+		},
+		{
+			name:     "regex with capture groups",
+			rewrite:  Rewrite{Regex: regexp.MustCompile(`^/u/([^/]+)/posts$`), Replacement: "/authors/$1/posts"},
+			target:   "/u/alice/posts",
+			wantPath: "/authors/alice/posts",
+		},
+		{
+			name:        "keeps encoded slash",
+			rewrite:     Rewrite{StripPrefix: "/files", AddPrefix: "/storage"},
+			target:      "/files/a%2Fb.txt",
+			wantPath:    "/storage/a/b.txt",
+			wantRawPath: "/storage/a%2Fb.txt",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.target)
+			assert.NoError(t, err)
+
+			tt.rewrite.Apply(u)
+			assert.Equal(t, tt.wantPath, u.Path)
+			assert.Equal(t, tt.wantRawPath, u.RawPath)
+		})
+	}
+}
+
+func TestJoinBackendPath(t *testing.T) {
+	tests := []struct {
+		backend Backend
+		target  string
+		want    string
+	}{
+		{Backend{Path: "/v2/"}, "/users?page=2", "/v2/users?page=2"},
+		{Backend{Path: "/v2"}, "/users", "/v2/users"},
+		{Backend{Path: "/v2", Query: "api_key=abc"}, "/users?page=2", "/v2/users?api_key=abc&page=2"},
+		{Backend{Query: "api_key=abc"}, "/users", "/users?api_key=abc"},
+		{Backend{Path: "/files/"}, "/a%2Fb", "/files/a%2Fb"},
+		{Backend{}, "/users", "/users"},
+	}
+
+	for _, tt := range tests {
+		u, err := url.Parse(tt.target)
+		assert.NoError(t, err)
+
+		joinBackendPath(u, tt.backend)
+		assert.Equal(t, tt.want, u.RequestURI())
+	}
+}
@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	MatcherHeader = "header"
+	MatcherQuery  = "query"
+	MatcherCookie = "cookie"
+)
+
+// MatchesPath reports whether the route applies to the given request path.
+// Prefix routes match on path segment boundaries, so "/api" matches
+// "/api" and "/api/users" but not "/apiary".
+func (r *Route) MatchesPath(path string) bool {
+	if r.Exact {
+		return path == r.Path
+	}
+
+	if !strings.HasPrefix(path, r.Path) {
+		return false
+	}
+
+	return len(path) == len(r.Path) ||
+		strings.HasSuffix(r.Path, "/") ||
+		path[len(r.Path)] == '/'
+}
+
+// Matches reports whether the request satisfies the route path, method and
+// every matcher of the route.
+func (r *Route) Matches(req *http.Request) bool {
+	if !r.MatchesPath(req.URL.Path) {
+		return false
+	}
+
+	if len(r.Methods) > 0 && !slices.Contains(r.Methods, req.Method) {
+		return false
+	}
+
+	for _, matcher := range r.Matchers {
+		if !matcher.Matches(req) {
+			return false
+		}
+	}
+	return true
+}
+
+// Matches reports whether any value of the named header, query parameter
+// or cookie equals the matcher value (or matches its regex). A matcher
+// without a value only requires the field to be present.
+func (m *Matcher) Matches(req *http.Request) bool {
+	var values []string
+	switch m.Type {
+	case MatcherHeader:
+		values = req.Header.Values(m.Name)
+	case MatcherQuery:
+		values = req.URL.Query()[m.Name]
+	case MatcherCookie:
+		for _, cookie := range req.CookiesNamed(m.Name) {
+			values = append(values, cookie.Value)
+		}
+	default:
+		return false
+	}
+
+	for _, value := range values {
+		if m.matchValue(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Matcher) matchValue(value string) bool {
+	if m.Regex != nil {
+		return m.Regex.MatchString(value)
+	}
+	return m.Value == "" || m.Value == value
+}
+
+// MatchRoute returns the first route matching the request in priority
+// order, or nil when the request should go to the proxy's default backends.
+func (c *TargetConfig) MatchRoute(req *http.Request) *Route {
+	for _, route := range c.Routes {
+		if route.Matches(req) {
+			return route
+		}
+	}
+	return nil
+}
+
+// sortRoutes orders routes by priority, then by the longest path, with
+// exact routes ahead of prefix routes of the same length.
+func sortRoutes(routes []*Route) {
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].Priority != routes[j].Priority {
+			return routes[i].Priority > routes[j].Priority
+		}
+		if len(routes[i].Path) != len(routes[j].Path) {
+			return len(routes[i].Path) > len(routes[j].Path)
+		}
+		return routes[i].Exact && !routes[j].Exact
+	})
+}
+
+func parseMethods(methods string) []string {
+	var parsed []string
+	for _, method := range strings.Split(methods, ",") {
+		if method = strings.ToUpper(strings.TrimSpace(method)); method != "" {
+			parsed = append(parsed, method)
+		}
+	}
+	return parsed
+}
@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchRouteLongestPrefix(t *testing.T) {
+	api := &Route{Path: "/api"}
+	apiV2 := &Route{Path: "/api/v2"}
+	health := &Route{Path: "/api/health", Exact: true}
+
+	config := &TargetConfig{Routes: []*Route{api, health, apiV2}}
+	sortRoutes(config.Routes)
+
+	get := func(target string) *http.Request {
+		return httptest.NewRequest(http.MethodGet, target, nil)
+	}
+
+	assert.Same(t, api, config.MatchRoute(get("/api")))
+	assert.Same(t, api, config.MatchRoute(get("/api/users")))
+	assert.Same(t, apiV2, config.MatchRoute(get("/api/v2/users")))
+	assert.Same(t, health, config.MatchRoute(get("/api/health")))
+	assert.Same(t, api, config.MatchRoute(get("/api/health/deep")))
+	assert.Nil(t, config.MatchRoute(get("/apiary")))
+	assert.Nil(t, config.MatchRoute(get("/")))
+}
+
+func TestMatchRouteTrailingSlashPrefix(t *testing.T) {
+	static := &Route{Path: "/static/"}
+	config := &TargetConfig{Routes: []*Route{static}}
+
+	assert.Same(t, static, config.MatchRoute(httptest.NewRequest(http.MethodGet, "/static/app.js", nil)))
+	assert.Nil(t, config.MatchRoute(httptest.NewRequest(http.MethodGet, "/static", nil)))
+}
+
+func TestMatchRouteMatchers(t *testing.T) {
+	beta := &Route{
+		Priority: 10,
+		Matchers: []Matcher{{Type: MatcherHeader, Name: "X-Tenant", Value: "beta"}},
+	}
+	preview := &Route{
+		Priority: 5,
+		Matchers: []Matcher{{Type: MatcherQuery, Name: "preview", Value: "1"}},
+	}
+	writes := &Route{
+		Path:    "/api",
+		Methods: parseMethods("post, put"),
+	}
+	canary := &Route{
+		Matchers: []Matcher{{Type: MatcherCookie, Name: "canary", Regex: regexp.MustCompile(`^(yes|true)$`)}},
+	}
+
+	config := &TargetConfig{Routes: []*Route{writes, canary, preview, beta}}
+	sortRoutes(config.Routes)
+
+	req := httptest.NewRequest(http.MethodGet, "/?preview=1", nil)
+	req.Header.Set("X-Tenant", "beta")
+	assert.Same(t, beta, config.MatchRoute(req))
+
+	req = httptest.NewRequest(http.MethodGet, "/?preview=1", nil)
+	assert.Same(t, preview, config.MatchRoute(req))
+
+	req = httptest.NewRequest(http.MethodPost, "/api/items", nil)
+	assert.Same(t, writes, config.MatchRoute(req))
+
+	req = httptest.NewRequest(http.MethodGet, "/api/items", nil)
+	req.AddCookie(&http.Cookie{Name: "canary", Value: "true"})
+	assert.Same(t, canary, config.MatchRoute(req))
+
+	req = httptest.NewRequest(http.MethodGet, "/api/items", nil)
+	req.AddCookie(&http.Cookie{Name: "canary", Value: "nope"})
+	assert.Nil(t, config.MatchRoute(req))
+}
@@ -2,73 +2,222 @@ package proxy
 
 import (
 	"errors"
+	"net/http"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
 )
 
 type Service interface {
-	GetTarget(domain string) (*SelectedTarget, error)
+	GetTarget(r *http.Request) (*SelectedTarget, error)
+	GetTCPTarget(proxyID string) (Backend, error)
+	GetPassthroughTarget(serverName string) (Backend, bool, error)
+	ListTCPProxies() ([]ProxyModel, error)
 }
 
 type service struct {
 	repository Repository
 	proxyCache *ProxyCache
+	signer     cookieSigner
 }
 
-func NewService(repository Repository, proxyCache *ProxyCache) Service {
+// NewService creates the proxy service. affinitySecret signs session
+// affinity cookies; when empty a random key is used.
+func NewService(repository Repository, proxyCache *ProxyCache, affinitySecret []byte) Service {
 	return &service{
 		repository: repository,
 		proxyCache: proxyCache,
+		signer:     newCookieSigner(affinitySecret),
 	}
 }
 
-func (s *service) GetTarget(domain string) (*SelectedTarget, error) {
-	currentTime := time.Now().UnixNano()
+func (s *service) GetTarget(r *http.Request) (*SelectedTarget, error) {
+	route, err := s.getHostConfig(normalizeHost(r.Host))
+	if err != nil {
+		return nil, err
+	}
 
-	config, cacheFound := s.proxyCache.Get(domain)
-	var route *TargetConfig
-	var nextIdx uint64
-	if cacheFound {
-		route = config.Route
-		nextIdx = config.NextIdx
+	pool := route.Pool
+	headers := route.Headers
+	redirect := route.Redirect
+	var rewrite *Rewrite
+	if matched := route.MatchRoute(r); matched != nil {
+		pool = matched.Pool
+		headers = matched.Headers
+		rewrite = matched.Rewrite
+		redirect = matched.Redirect
+	}
 
-		if config.Route == nil {
-			return nil, ErrNoRouteFound // cached but route is nil
-		}
+	if redirect != nil {
+		return &SelectedTarget{
+			ForceHTTPS: route.ForceHTTPS,
+			Redirect:   redirect,
+		}, nil
+	}
+
+	if pool == nil {
+		return nil, ErrNoRouteFound
+	}
+
+	chosenBackend, ticket, cookies, affinity, err := s.nextBackend(pool, r)
+	if err != nil {
+		return nil, err
 	}
 
-	if !cacheFound || currentTime > config.ExpiryTime {
-		configFromDB, err := s.repository.GetTargetConfig(domain)
-		if err != nil {
+	if len(headers) == 0 {
+		headers = make(map[string]string)
+	}
+
+	return &SelectedTarget{
+		Backend:         chosenBackend,
+		ticket:          ticket,
+		Cookies:         cookies,
+		affinity:        affinity,
+		Pool:            pool,
+		Outlier:         pool.Outlier,
+		Retry:           pool.Retry,
+		Headers:         headers,
+		ForceHTTPS:      route.ForceHTTPS,
+		Rewrite:         rewrite,
+		HostHeaderMode:  route.HostHeaderMode,
+		HostHeaderValue: route.HostHeaderValue,
+		Mirrors:         route.Mirrors,
+		MirrorBodyLimit: route.MirrorBodyLimit,
+	}, nil
+}
 
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-				s.proxyCache.Set(domain, nil)
-				return nil, ErrNoRouteFound
+// nextBackend honours a valid session affinity cookie as long as its
+// backend still takes traffic, and balances normally otherwise. The
+// affinity cookie, nil when the pool has no affinity, is only set once a
+// backend answered.
+func (s *service) nextBackend(pool *Pool, r *http.Request) (Backend, *breakerTicket, []*http.Cookie, *affinityCookie, error) {
+	var affinity *affinityCookie
+	if pool.Affinity != nil {
+		affinity = &affinityCookie{affinity: pool.Affinity, signer: s.signer}
+		if cookie, err := r.Cookie(pool.Affinity.Cookie); err == nil {
+			if id, ok := s.signer.verify(cookie.Value); ok {
+				if backend, ticket, ok := pool.Lookup(id); ok {
+					affinity.pinned = id
+					return backend, ticket, nil, affinity, nil
+				}
 			}
+		}
+	}
+
+	backend, ticket, groupCookie, err := pool.Next(r)
+	if err != nil {
+		return Backend{}, nil, nil, nil, err
+	}
+
+	var cookies []*http.Cookie
+	if groupCookie != nil {
+		cookies = append(cookies, groupCookie)
+	}
+	return backend, ticket, cookies, affinity, nil
+}
+
+func (s *service) GetTCPTarget(proxyID string) (Backend, error) {
+	route, err := s.getConfig("tcp:"+proxyID, func() (*TargetConfig, error) {
+		return s.repository.GetTCPTargetConfig(proxyID)
+	})
+	if err != nil {
+		return Backend{}, err
+	}
 
-			return &SelectedTarget{}, err
+	backend, _, _, err := route.Pool.Next(nil)
+	return backend, err
+}
+
+// GetPassthroughTarget returns the backend for a TLS connection whose SNI
+// names a passthrough host. ok is false when the proxy should terminate
+// TLS itself.
+func (s *service) GetPassthroughTarget(serverName string) (backend Backend, ok bool, err error) {
+	route, err := s.getHostConfig(normalizeHost(serverName))
+	if err != nil {
+		if errors.Is(err, ErrNoRouteFound) {
+			return Backend{}, false, nil
 		}
-		s.proxyCache.Set(domain, configFromDB)
-		route = configFromDB
+		return Backend{}, false, err
 	}
 
-	backends := route.Backends
-	numBackends := len(backends)
-	if numBackends == 0 {
-		return nil, ErrNoRouteFound
+	if !route.TLSPassthrough || route.Pool == nil {
+		return Backend{}, false, nil
 	}
 
-	backendIndex := (nextIdx) % uint64(numBackends)
+	backend, _, _, err = route.Pool.Next(nil)
+	return backend, err == nil, err
+}
+
+func (s *service) ListTCPProxies() ([]ProxyModel, error) {
+	return s.repository.ListTCPProxies()
+}
 
-	chosenBackend := backends[backendIndex]
-	if len(route.Headers) == 0 {
-		route.Headers = make(map[string]string)
+// getHostConfig returns the config of the stored host serving domain.
+// Every domain a wildcard host serves shares the one config and its pools.
+func (s *service) getHostConfig(domain string) (*TargetConfig, error) {
+	hostID, err := s.getHostID(domain)
+	if err != nil {
+		return nil, err
 	}
 
-	return &SelectedTarget{
-		Backend:    chosenBackend,
-		Headers:    route.Headers,
-		ForceHTTPS: route.ForceHTTPS,
-	}, nil
+	return s.getConfig("host:"+hostID, func() (*TargetConfig, error) {
+		return s.repository.GetHostConfig(hostID)
+	})
+}
+
+// getHostID returns the cached ID of the stored host serving domain,
+// looking it up when missing or expired. Unknown domains are cached too
+// and reported as ErrNoRouteFound.
+func (s *service) getHostID(domain string) (string, error) {
+	if hostID, found := s.proxyCache.GetHostID(domain); found {
+		if hostID == "" {
+			return "", ErrNoRouteFound
+		}
+		return hostID, nil
+	}
+
+	hostID, err := s.repository.FindHostID(domain)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			s.proxyCache.SetHostID(domain, "")
+			return "", ErrNoRouteFound
+		}
+		return "", err
+	}
+
+	s.proxyCache.SetHostID(domain, hostID)
+	return hostID, nil
+}
+
+// getConfig returns the cached config under key, loading it when missing
+// or expired. Unknown keys are cached too and reported as ErrNoRouteFound.
+func (s *service) getConfig(key string, load func() (*TargetConfig, error)) (*TargetConfig, error) {
+	currentTime := time.Now().UnixNano()
+
+	config, cacheFound := s.proxyCache.Get(key)
+	if cacheFound && currentTime <= config.ExpiryTime {
+		if config.Route == nil {
+			return nil, ErrNoRouteFound // cached but route is nil
+		}
+		return config.Route, nil
+	}
+
+	configFromDB, err := load()
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			s.proxyCache.Set(key, nil)
+			return nil, ErrNoRouteFound
+		}
+		return nil, err
+	}
+
+	s.proxyCache.Set(key, configFromDB)
+	return configFromDB, nil
+}
+
+// normalizeHost turns a Host header into the concrete host name used for
+// lookups and as the cache key, dropping any port.
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(stripPort(host)), ".")
 }
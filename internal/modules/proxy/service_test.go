@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+type stubRepository struct {
+	Repository
+	pool    *Pool
+	lookups int
+	loads   int
+}
+
+// FindHostID serves every *.example.com domain from one wildcard host.
+func (r *stubRepository) FindHostID(domain string) (string, error) {
+	r.lookups++
+	if !strings.HasSuffix(domain, ".example.com") {
+		return "", gorm.ErrRecordNotFound
+	}
+	return "wildcard", nil
+}
+
+func (r *stubRepository) GetHostConfig(hostID string) (*TargetConfig, error) {
+	r.loads++
+	return &TargetConfig{Pool: r.pool, Headers: map[string]string{}}, nil
+}
+
+func TestWildcardSubdomainsShareConfig(t *testing.T) {
+	repository := &stubRepository{pool: newPool([]Backend{{ID: "shared"}}, nil, ProxyModel{})}
+	s := NewService(repository, NewProxyCache(time.Minute), nil).(*service)
+
+	var configs []*TargetConfig
+	for _, host := range []string{"a.example.com", "b.example.com", "a.example.com", "c.example.com:8443"} {
+		config, err := s.getHostConfig(normalizeHost(host))
+		assert.NoError(t, err)
+		configs = append(configs, config)
+	}
+	for _, config := range configs[1:] {
+		assert.Same(t, configs[0], config)
+	}
+	assert.Equal(t, 3, repository.lookups)
+	assert.Equal(t, 1, repository.loads)
+
+	// unknown hosts are cached as such
+	for range 2 {
+		_, err := s.GetTarget(httptest.NewRequest(http.MethodGet, "http://example.org/", nil))
+		assert.ErrorIs(t, err, ErrNoRouteFound)
+	}
+	assert.Equal(t, 4, repository.lookups)
+}
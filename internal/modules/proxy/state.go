@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const statePruneInterval = 10 * time.Minute
+
+// backendState is what the proxy learns about a backend at run time. It
+// lives outside the cached configs, so it is shared by every pool of the
+// proxy and survives reloads.
+type backendState struct {
+	inFlight atomic.Int64 // requests and connections in progress
+	down     atomic.Bool  // set by active health checks
+	stats    backendStats
+	outlier  outlierState
+	breaker  breakerState
+}
+
+// backendStates keeps backendState per backend ID.
+var backendStates sync.Map // map[string]*backendState
+
+func stateFor(backend Backend) *backendState {
+	if state, ok := backendStates.Load(backend.ID); ok {
+		return state.(*backendState)
+	}
+	state, _ := backendStates.LoadOrStore(backend.ID, new(backendState))
+	return state.(*backendState)
+}
+
+// StatePruner drops the run-time state of deleted backends and proxies.
+// Disabled ones keep theirs, so a backend disabled for a moment comes
+// back with its history.
+type StatePruner struct {
+	repository Repository
+}
+
+func NewStatePruner(repository Repository) *StatePruner {
+	return &StatePruner{repository: repository}
+}
+
+// Run prunes the state every statePruneInterval until ctx is done.
+func (p *StatePruner) Run(ctx context.Context) {
+	ticker := time.NewTicker(statePruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		proxyIDs, err := p.repository.ListProxyIDs()
+		if err != nil {
+			log.Printf("Error loading proxies to prune state: %v", err)
+			continue
+		}
+		backendIDs, err := p.repository.ListBackendIDs()
+		if err != nil {
+			log.Printf("Error loading backends to prune state: %v", err)
+			continue
+		}
+		pruneStates(proxyIDs, backendIDs)
+	}
+}
+
+// pruneStates forgets the state of every proxy and backend not listed.
+func pruneStates(proxyIDs, backendIDs []string) {
+	prune(&retryBudgets, proxyIDs)
+	prune(&backendStates, backendIDs)
+}
+
+func prune(states *sync.Map, ids []string) {
+	keep := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		keep[id] = true
+	}
+
+	states.Range(func(id, _ any) bool {
+		if !keep[id.(string)] {
+			states.Delete(id)
+		}
+		return true
+	})
+}
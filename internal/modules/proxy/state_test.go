@@ -0,0 +1,29 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPruneStates(t *testing.T) {
+	kept, removed := Backend{ID: "state-kept"}, Backend{ID: "state-removed"}
+	defer backendStates.Delete(kept.ID)
+	defer retryBudgets.Delete("proxy-kept")
+
+	stateFor(kept).inFlight.Add(1)
+	stateFor(removed).inFlight.Add(1)
+	retryBudgetFor("proxy-kept", 20)
+	retryBudgetFor("proxy-removed", 20)
+
+	pruneStates([]string{"proxy-kept"}, []string{kept.ID})
+
+	_, ok := backendStates.Load(removed.ID)
+	assert.False(t, ok)
+	assert.Equal(t, int64(1), stateFor(kept).inFlight.Load())
+
+	_, ok = retryBudgets.Load("proxy-removed")
+	assert.False(t, ok)
+	_, ok = retryBudgets.Load("proxy-kept")
+	assert.True(t, ok)
+}
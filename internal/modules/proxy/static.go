@@ -0,0 +1,132 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const SchemeFile = "file"
+
+var precompressed = []struct {
+	encoding  string
+	extension string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// serveStatic serves urlPath from the directory of a file backend
+// (Backend.Host). Directories resolve to their index files, extension-less
+// paths fall back to index.html when SPAFallback is on, and .br/.gz
+// siblings are served when the client accepts them.
+func serveStatic(w http.ResponseWriter, r *http.Request, backend Backend, urlPath string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// os.Root keeps every lookup, symlinks included, inside the directory
+	root, err := os.OpenRoot(backend.Host)
+	if err != nil {
+		http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	defer root.Close()
+
+	name := strings.TrimPrefix(path.Clean("/"+urlPath), "/")
+	if name == "" {
+		name = "."
+	}
+
+	info, err := root.Stat(name)
+	if err == nil && info.IsDir() {
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			target := r.URL.Path + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return
+		}
+		name, info, err = findIndex(root, name, backend.IndexFiles)
+	}
+
+	if errors.Is(err, fs.ErrNotExist) && backend.SPAFallback && path.Ext(name) == "" {
+		name, info, err = findIndex(root, ".", backend.IndexFiles)
+	}
+
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	w.Header().Add("Vary", "Accept-Encoding")
+	for _, variant := range precompressed {
+		if !acceptsEncoding(r.Header.Get("Accept-Encoding"), variant.encoding) {
+			continue
+		}
+		variantInfo, err := root.Stat(name + variant.extension)
+		if err != nil || variantInfo.IsDir() {
+			continue
+		}
+		w.Header().Set("Content-Encoding", variant.encoding)
+		name, info = name+variant.extension, variantInfo
+		break
+	}
+
+	file, err := root.Open(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+
+	// handles Range, If-Range, If-None-Match and If-Modified-Since
+	http.ServeContent(w, r, name, info.ModTime(), file)
+}
+
+func findIndex(root *os.Root, dir string, indexFiles []string) (string, fs.FileInfo, error) {
+	for _, index := range indexFiles {
+		name := path.Join(dir, index)
+		if info, err := root.Stat(name); err == nil && !info.IsDir() {
+			return name, info, nil
+		}
+	}
+	return dir, nil, fs.ErrNotExist
+}
+
+func acceptsEncoding(header, encoding string) bool {
+	for _, part := range strings.Split(header, ",") {
+		token, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(token), encoding) {
+			continue
+		}
+		q, ok := strings.CutPrefix(strings.TrimSpace(params), "q=")
+		if !ok {
+			return true
+		}
+		weight, err := strconv.ParseFloat(q, 64)
+		return err == nil && weight > 0
+	}
+	return false
+}
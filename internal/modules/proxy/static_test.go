@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newStaticBackend(t *testing.T) Backend {
+	dir := t.TempDir()
+	files := map[string]string{
+		"index.html":     "<h1>home</h1>",
+		"app.js":         "console.log('plain')",
+		"app.js.br":      "brotli-bytes",
+		"docs/index.htm": "docs",
+	}
+	for name, content := range files {
+		full := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(full), 0o755))
+		assert.NoError(t, os.WriteFile(full, []byte(content), 0o644))
+	}
+
+	return Backend{
+		Scheme:      SchemeFile,
+		Host:        dir,
+		IndexFiles:  []string{"index.html", "index.htm"},
+		SPAFallback: true,
+	}
+}
+
+func serveStaticPath(backend Backend, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	serveStatic(w, r, backend, r.URL.Path)
+	return w
+}
+
+func TestServeStaticIndexAndFallback(t *testing.T) {
+	backend := newStaticBackend(t)
+
+	w := serveStaticPath(backend, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "<h1>home</h1>", w.Body.String())
+
+	w = serveStaticPath(backend, httptest.NewRequest(http.MethodGet, "/docs/", nil))
+	assert.Equal(t, "docs", w.Body.String())
+
+	w = serveStaticPath(backend, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "/docs/", w.Header().Get("Location"))
+
+	w = serveStaticPath(backend, httptest.NewRequest(http.MethodGet, "/settings/profile", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "<h1>home</h1>", w.Body.String())
+
+	w = serveStaticPath(backend, httptest.NewRequest(http.MethodGet, "/missing.css", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	backend.SPAFallback = false
+	w = serveStaticPath(backend, httptest.NewRequest(http.MethodGet, "/../../etc/passwd", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestServeStaticPrecompressedAndConditional(t *testing.T) {
+	backend := newStaticBackend(t)
+
+	r := httptest.NewRequest(http.MethodGet, "/app.js", nil)
+	r.Header.Set("Accept-Encoding", "gzip, br")
+	w := serveStaticPath(backend, r)
+	assert.Equal(t, "br", w.Header().Get("Content-Encoding"))
+	assert.Contains(t, w.Header().Get("Content-Type"), "javascript")
+	assert.Equal(t, "brotli-bytes", w.Body.String())
+
+	r = httptest.NewRequest(http.MethodGet, "/app.js", nil)
+	r.Header.Set("Accept-Encoding", "br;q=0")
+	w = serveStaticPath(backend, r)
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+	assert.NotEmpty(t, w.Header().Get("Last-Modified"))
+
+	r = httptest.NewRequest(http.MethodGet, "/app.js", nil)
+	r.Header.Set("If-None-Match", etag)
+	w = serveStaticPath(backend, r)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	r = httptest.NewRequest(http.MethodGet, "/app.js", nil)
+	r.Header.Set("Range", "bytes=0-6")
+	w = serveStaticPath(backend, r)
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "console", w.Body.String())
+}
@@ -0,0 +1,194 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"time"
+
+	"github.com/mimamch/reverse-proxy/internal/utils"
+)
+
+// TCPHandler forwards raw connections accepted on a proxy's listen port
+// to the proxy's backends.
+type TCPHandler struct {
+	service Service
+}
+
+func NewTCPHandler(service Service) *TCPHandler {
+	return &TCPHandler{
+		service: service,
+	}
+}
+
+// Serve accepts connections on ln for the given proxy until ln is closed.
+func (h *TCPHandler) Serve(ln net.Listener, proxyID string) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				time.Sleep(5 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+
+		go h.handleConn(conn, proxyID)
+	}
+}
+
+func (h *TCPHandler) handleConn(conn net.Conn, proxyID string) {
+	defer conn.Close()
+
+	backend, err := h.service.GetTCPTarget(proxyID)
+	if err != nil {
+		log.Printf("Error getting TCP target for proxy %s: %v", proxyID, err)
+		return
+	}
+	defer trackInFlight(backend)()
+
+	upstream, err := dialBackend(context.Background(), backend)
+	if err != nil {
+		log.Printf("TCP Proxy Error: %v", err)
+		return
+	}
+	defer upstream.Close()
+
+	if backend.ProxyProtocol != 0 {
+		if err := utils.WriteProxyHeader(upstream, backend.ProxyProtocol, conn.RemoteAddr(), conn.LocalAddr()); err != nil {
+			log.Printf("TCP Proxy Error: %v", err)
+			return
+		}
+	}
+
+	pipe(conn, upstream)
+}
+
+// TCPListeners keeps the listeners of TCP proxies in line with the
+// database, reloading them as often as the health checker reloads its
+// settings. Closing a listener leaves its open connections alone.
+type TCPListeners struct {
+	handler *TCPHandler
+	listen  func(addr string) (net.Listener, error)
+	count   int // listeners per port
+	open    map[string]*tcpListenerSet
+}
+
+type tcpListenerSet struct {
+	port      int
+	listeners []net.Listener
+}
+
+// NewTCPListeners opens count listeners per TCP proxy port with listen.
+func NewTCPListeners(handler *TCPHandler, listen func(addr string) (net.Listener, error), count int) *TCPListeners {
+	return &TCPListeners{
+		handler: handler,
+		listen:  listen,
+		count:   count,
+		open:    make(map[string]*tcpListenerSet),
+	}
+}
+
+// Run keeps the listeners in line with the database until ctx is done,
+// then closes them.
+func (l *TCPListeners) Run(ctx context.Context) {
+	ticker := time.NewTicker(healthCheckReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		proxies, err := l.handler.service.ListTCPProxies()
+		if err != nil {
+			log.Printf("Error loading TCP proxies: %v", err)
+		} else {
+			l.sync(proxies)
+		}
+
+		select {
+		case <-ctx.Done():
+			l.sync(nil)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sync closes the listeners of removed or moved proxies, then opens the
+// missing ones. A port that fails to open is retried on the next sync.
+func (l *TCPListeners) sync(proxies []ProxyModel) {
+	ports := make(map[string]int, len(proxies))
+	for _, proxy := range proxies {
+		if proxy.ListenPort != nil {
+			ports[proxy.ID] = *proxy.ListenPort
+		}
+	}
+
+	for id, set := range l.open {
+		if port, ok := ports[id]; !ok || port != set.port {
+			log.Printf("Closing TCP proxy listener(s) on :%d", set.port)
+			for _, ln := range set.listeners {
+				ln.Close()
+			}
+			delete(l.open, id)
+		}
+	}
+
+	for id, port := range ports {
+		if _, ok := l.open[id]; ok {
+			continue
+		}
+		set, err := l.openSet(port)
+		if err != nil {
+			log.Printf("Failed to listen on :%d: %v", port, err)
+			continue
+		}
+		log.Printf("Starting %d TCP proxy listener(s) on :%d", l.count, port)
+		for _, ln := range set.listeners {
+			go l.handler.Serve(ln, id)
+		}
+		l.open[id] = set
+	}
+}
+
+func (l *TCPListeners) openSet(port int) (*tcpListenerSet, error) {
+	set := &tcpListenerSet{port: port}
+	for range l.count {
+		ln, err := l.listen(fmt.Sprintf(":%d", port))
+		if err != nil {
+			for _, opened := range set.listeners {
+				opened.Close()
+			}
+			return nil, err
+		}
+		set.listeners = append(set.listeners, ln)
+	}
+	return set, nil
+}
+
+// pipe copies bytes in both directions until both sides are done,
+// propagating half-closes so protocols relying on them keep working.
+func pipe(client, upstream net.Conn) {
+	done := make(chan struct{}, 2)
+
+	copyHalf := func(dst, src net.Conn) {
+		io.Copy(dst, src)
+		if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+			cw.CloseWrite()
+		} else {
+			dst.Close()
+		}
+		done <- struct{}{}
+	}
+
+	go copyHalf(upstream, client)
+	go copyHalf(client, upstream)
+
+	<-done
+	<-done
+}
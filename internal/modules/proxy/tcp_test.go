@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// serveEcho answers the first line read on ln with "echo " and the line.
+func serveEcho(ln net.Listener) {
+	conn, err := ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	line, _ := bufio.NewReader(conn).ReadString('\n')
+	conn.Write([]byte("echo " + line))
+}
+
+func assertTCPForwards(t *testing.T, backend Backend) {
+	handler := NewTCPHandler(&stubService{target: &SelectedTarget{Backend: backend}})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+	go handler.Serve(ln, "proxy-1")
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("ping\n"))
+	assert.NoError(t, err)
+
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "echo ping\n", reply)
+}
+
+func TestTCPHandlerForwardsBytes(t *testing.T) {
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer upstream.Close()
+	go serveEcho(upstream)
+
+	addr := upstream.Addr().(*net.TCPAddr)
+	assertTCPForwards(t, Backend{Scheme: "tcp", Host: addr.IP.String(), Port: addr.Port})
+}
+
+func TestTCPHandlerForwardsToUnixSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "app.sock")
+	upstream, err := net.Listen("unix", socketPath)
+	assert.NoError(t, err)
+	defer upstream.Close()
+	go serveEcho(upstream)
+
+	assertTCPForwards(t, Backend{Scheme: SchemeUnix, Host: socketPath})
+}
+
+func TestDialBackendWithoutPort(t *testing.T) {
+	_, err := dialBackend(context.Background(), Backend{ID: "no-port", Scheme: "tcp", Host: "127.0.0.1"})
+	assert.ErrorContains(t, err, "has no port")
+}
+
+func TestTCPListenersSync(t *testing.T) {
+	var addrs []string
+	listen := func(addr string) (net.Listener, error) {
+		addrs = append(addrs, addr)
+		return net.Listen("tcp", "127.0.0.1:0")
+	}
+	listeners := NewTCPListeners(NewTCPHandler(&stubService{}), listen, 2)
+	defer listeners.sync(nil)
+
+	port, otherPort := 7000, 7001
+	listeners.sync([]ProxyModel{{ID: "tcp-1", ListenPort: &port}})
+	first := listeners.open["tcp-1"]
+	assert.Len(t, first.listeners, 2)
+	assert.Equal(t, []string{":7000", ":7000"}, addrs)
+
+	// unchanged proxies keep their listeners
+	listeners.sync([]ProxyModel{{ID: "tcp-1", ListenPort: &port}})
+	assert.Same(t, first, listeners.open["tcp-1"])
+
+	// a moved proxy gets new listeners, the old ones are closed
+	listeners.sync([]ProxyModel{{ID: "tcp-1", ListenPort: &otherPort}})
+	assert.Equal(t, otherPort, listeners.open["tcp-1"].port)
+	_, err := first.listeners[0].Accept()
+	assert.ErrorIs(t, err, net.ErrClosed)
+
+	listeners.sync(nil)
+	assert.Empty(t, listeners.open)
+}
@@ -0,0 +1,260 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mimamch/reverse-proxy/internal/utils"
+)
+
+var transport = &http.Transport{
+	// ===== Connection reuse (keepalive) =====
+	MaxIdleConns:        4096,
+	MaxIdleConnsPerHost: 512,
+	MaxConnsPerHost:     0,
+	IdleConnTimeout:     120 * time.Second, // keepalive_timeout
+
+	// ===== Timeouts =====
+	// ResponseHeaderTimeout: 60 * time.Second, // proxy_read_timeout
+	// ExpectContinueTimeout: 1 * time.Second,
+
+	// ===== Dialing =====
+	DialContext: (&net.Dialer{
+		Timeout:   5 * time.Second,  // proxy_connect_timeout
+		KeepAlive: 30 * time.Second, // tcp_keepalive_time
+	}).DialContext,
+
+	// ===== HTTP/2 =====
+	ForceAttemptHTTP2: true, // nginx http2 on;
+
+	// ===== TLS (upstream) =====
+	TLSHandshakeTimeout: 10 * time.Second,
+	TLSClientConfig: &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	},
+
+	// ===== Disable compression (match nginx proxy) =====
+	DisableCompression: true,
+}
+
+const (
+	SchemeUnix = "unix"
+	SchemeH2C  = "h2c" // HTTP/2 over cleartext TCP with prior knowledge, e.g. gRPC
+)
+
+// transportKey describes how a backend must be reached. Each distinct key
+// gets its own clone of transport, so pooled connections are never shared
+// between different SNI values, sockets or PROXY protocol settings.
+type transportKey struct {
+	h2c           bool
+	serverName    string
+	socketPath    string
+	proxyProtocol int
+}
+
+// maxTransports bounds the transports kept. In preserve mode the server
+// name comes from the client, e.g. any subdomain of a wildcard host, so
+// the least recently used transports go.
+const maxTransports = 256
+
+var transports = newLRUCache[transportKey, *http.Transport](maxTransports, func(t *http.Transport) {
+	t.CloseIdleConnections()
+})
+
+// transportFor returns the transport to reach backend. serverName overrides
+// the TLS SNI for https backends; empty keeps the backend host.
+func transportFor(backend Backend, serverName string) http.RoundTripper {
+	key := transportKey{proxyProtocol: backend.ProxyProtocol}
+	switch backend.Scheme {
+	case SchemeUnix:
+		key.socketPath = backend.Host
+	case SchemeH2C:
+		key.h2c = true
+	case "https":
+		if serverName != backend.Host {
+			key.serverName = serverName
+		}
+	}
+
+	if key == (transportKey{}) {
+		return transport
+	}
+
+	return transports.getOrAdd(key, func() *http.Transport {
+		return newTransport(key)
+	})
+}
+
+var backendDialer = &net.Dialer{
+	Timeout:   5 * time.Second,
+	KeepAlive: 30 * time.Second,
+}
+
+// dialBackend opens a connection to backend: to the socket of unix
+// backends, else to host and port, where a missing port defaults to the
+// one of the scheme.
+func dialBackend(ctx context.Context, backend Backend) (net.Conn, error) {
+	if backend.Scheme == SchemeUnix {
+		return backendDialer.DialContext(ctx, "unix", backend.Host)
+	}
+
+	port := backend.Port
+	if port == 0 {
+		switch backend.Scheme {
+		case "http", SchemeH2C:
+			port = 80
+		case "https":
+			port = 443
+		default:
+			return nil, fmt.Errorf("backend %s (%s) has no port", backend.ID, backend.Host)
+		}
+	}
+	return backendDialer.DialContext(ctx, "tcp", net.JoinHostPort(backend.Host, strconv.Itoa(port)))
+}
+
+func newTransport(key transportKey) *http.Transport {
+	t := transport.Clone()
+
+	dial := backendDialer.DialContext
+
+	if key.socketPath != "" {
+		backend := Backend{Scheme: SchemeUnix, Host: key.socketPath}
+		dial = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialBackend(ctx, backend)
+		}
+	}
+
+	// h2c speaks HTTP/2 without TLS; http.Transport only negotiates HTTP/2
+	// through TLS ALPN, so cleartext backends would otherwise get HTTP/1.1
+	if key.h2c {
+		t.Protocols = new(http.Protocols)
+		t.Protocols.SetUnencryptedHTTP2(true)
+	}
+
+	if key.serverName != "" {
+		t.TLSClientConfig.ServerName = key.serverName
+	}
+
+	if key.proxyProtocol != 0 {
+		// the header names one client, so connections cannot be reused
+		t.DisableKeepAlives = true
+		baseDial := dial
+		dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := baseDial(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			src, dst := proxyAddrsFromContext(ctx)
+			if err := utils.WriteProxyHeader(conn, key.proxyProtocol, src, dst); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return conn, nil
+		}
+	}
+
+	t.DialContext = dial
+	return t
+}
+
+type proxyAddrsKey struct{}
+
+type proxyAddrs struct {
+	src net.Addr
+	dst net.Addr
+}
+
+// withProxyAddrs records the client and listener addresses announced in
+// PROXY protocol headers sent upstream.
+func withProxyAddrs(ctx context.Context, src, dst net.Addr) context.Context {
+	return context.WithValue(ctx, proxyAddrsKey{}, proxyAddrs{src: src, dst: dst})
+}
+
+func proxyAddrsFromContext(ctx context.Context) (net.Addr, net.Addr) {
+	addrs, _ := ctx.Value(proxyAddrsKey{}).(proxyAddrs)
+	return addrs.src, addrs.dst
+}
+
+// clientProxyAddrs returns the addresses of the incoming request for a
+// PROXY protocol header: the real client IP and the local listener.
+func clientProxyAddrs(r *http.Request) (net.Addr, net.Addr) {
+	src := &net.TCPAddr{IP: utils.GetRealClientIP(r)}
+	if _, port, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		src.Port, _ = strconv.Atoi(port)
+	}
+
+	dst, _ := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if src.IP == nil {
+		return nil, dst
+	}
+	return src, dst
+}
+
+// upstreamScheme is the URL scheme spoken to backend over the wire.
+func upstreamScheme(backend Backend) string {
+	switch backend.Scheme {
+	case SchemeUnix, SchemeH2C:
+		return "http"
+	}
+	return backend.Scheme
+}
+
+// ServerName returns the upstream TLS SNI matching the Host header policy
+// for the client request r, empty to keep the backend host.
+func (t *SelectedTarget) ServerName(r *http.Request) string {
+	switch t.HostHeaderMode {
+	case HostHeaderBackend:
+		return ""
+	case HostHeaderFixed:
+		return stripPort(t.HostHeaderValue)
+	default:
+		return clientServerName(r)
+	}
+}
+
+// clientServerName is the SNI the client sent, or its Host when it sent
+// none, as long as that is a valid DNS name. IP addresses are never sent
+// as SNI.
+func clientServerName(r *http.Request) string {
+	name := normalizeHost(r.Host)
+	if r.TLS != nil && r.TLS.ServerName != "" {
+		name = normalizeHost(r.TLS.ServerName)
+	}
+	if !isDNSName(name) {
+		return ""
+	}
+	return name
+}
+
+// isDNSName reports whether name, already lower case, is a host name made
+// of letters, digits and hyphens.
+func isDNSName(name string) bool {
+	if name == "" || len(name) > 253 || net.ParseIP(name) != nil {
+		return false
+	}
+
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func stripPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
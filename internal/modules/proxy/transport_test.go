@@ -0,0 +1,33 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnixSocketBackend(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "app.sock")
+	ln, err := net.Listen("unix", socketPath)
+	assert.NoError(t, err)
+
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host + r.URL.Path))
+	})}
+	go server.Serve(ln)
+	defer server.Close()
+
+	handler := NewHandler(&stubService{target: &SelectedTarget{
+		Backend: Backend{Scheme: SchemeUnix, Host: socketPath},
+	}})
+
+	w := httptest.NewRecorder()
+	handler.HandleRequest(w, httptest.NewRequest(http.MethodGet, "http://app.example.com/hello", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "app.example.com/hello", w.Body.String())
+}
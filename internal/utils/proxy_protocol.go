@@ -0,0 +1,278 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const proxyHeaderTimeout = 5 * time.Second
+
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+var errInvalidProxyHeader = errors.New("invalid PROXY protocol header")
+
+// ParseCIDRs parses a comma separated CIDR list, e.g. from an env var.
+func ParseCIDRs(list string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, cidr := range strings.Split(list, ",") {
+		if cidr = strings.TrimSpace(cidr); cidr == "" {
+			continue
+		}
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipnet)
+	}
+	return nets, nil
+}
+
+// ProxyProtocolListener reads PROXY protocol v1/v2 headers from
+// connections whose source is in trusted, and reports the client address
+// from the header as RemoteAddr. Connections from other sources are
+// returned untouched so clients cannot spoof their address.
+type ProxyProtocolListener struct {
+	net.Listener
+	trusted []*net.IPNet
+}
+
+func NewProxyProtocolListener(ln net.Listener, trusted []*net.IPNet) net.Listener {
+	return &ProxyProtocolListener{Listener: ln, trusted: trusted}
+}
+
+func (l *ProxyProtocolListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	addr, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok || !containsIP(l.trusted, addr.IP) {
+		return conn, nil
+	}
+
+	// the header is parsed lazily, on the connection's own goroutine
+	return &proxyProtocolConn{Conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, ipnet := range nets {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+type proxyProtocolConn struct {
+	net.Conn
+	reader *bufio.Reader
+
+	once       sync.Once
+	err        error
+	remoteAddr net.Addr
+	localAddr  net.Addr
+}
+
+func (c *proxyProtocolConn) parse() {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+		c.remoteAddr, c.localAddr, c.err = readProxyHeader(c.reader)
+		c.Conn.SetReadDeadline(time.Time{})
+		if c.err != nil {
+			c.Conn.Close()
+		}
+	})
+}
+
+func (c *proxyProtocolConn) Read(p []byte) (int, error) {
+	c.parse()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(p)
+}
+
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	c.parse()
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyProtocolConn) LocalAddr() net.Addr {
+	c.parse()
+	if c.localAddr != nil {
+		return c.localAddr
+	}
+	return c.Conn.LocalAddr()
+}
+
+func (c *proxyProtocolConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return c.Conn.Close()
+}
+
+// readProxyHeader consumes a v1 or v2 header. Nil addresses mean the
+// header carried none (UNKNOWN / LOCAL) and the socket addresses apply.
+func readProxyHeader(r *bufio.Reader) (src, dst net.Addr, err error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch first[0] {
+	case 'P':
+		return readProxyHeaderV1(r)
+	case '\r':
+		return readProxyHeaderV2(r)
+	}
+	return nil, nil, errInvalidProxyHeader
+}
+
+func readProxyHeaderV1(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	// the longest v1 header is 107 bytes
+	var line []byte
+	for len(line) < 107 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, nil, errInvalidProxyHeader
+	}
+
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) < 2 || fields[0] != "PROXY" {
+		return nil, nil, errInvalidProxyHeader
+	}
+	if fields[1] == "UNKNOWN" {
+		return nil, nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, nil, errInvalidProxyHeader
+	}
+
+	src, err := parseTCPAddr(fields[2], fields[4])
+	if err != nil {
+		return nil, nil, err
+	}
+	dst, err := parseTCPAddr(fields[3], fields[5])
+	if err != nil {
+		return nil, nil, err
+	}
+	return src, dst, nil
+}
+
+func parseTCPAddr(ip, port string) (*net.TCPAddr, error) {
+	parsedIP := net.ParseIP(ip)
+	parsedPort, err := strconv.ParseUint(port, 10, 16)
+	if parsedIP == nil || err != nil {
+		return nil, errInvalidProxyHeader
+	}
+	return &net.TCPAddr{IP: parsedIP, Port: int(parsedPort)}, nil
+}
+
+func readProxyHeaderV2(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, err
+	}
+	if !bytes.Equal(header[:12], proxyV2Signature) || header[12]>>4 != 2 {
+		return nil, nil, errInvalidProxyHeader
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, nil, err
+	}
+
+	// LOCAL command: health checks from the load balancer itself
+	if header[12]&0x0f == 0 {
+		return nil, nil, nil
+	}
+
+	var ipLen int
+	switch header[13] >> 4 {
+	case 1: // AF_INET
+		ipLen = net.IPv4len
+	case 2: // AF_INET6
+		ipLen = net.IPv6len
+	default:
+		return nil, nil, nil
+	}
+	if len(payload) < 2*ipLen+4 {
+		return nil, nil, errInvalidProxyHeader
+	}
+
+	src := &net.TCPAddr{
+		IP:   net.IP(payload[:ipLen]),
+		Port: int(binary.BigEndian.Uint16(payload[2*ipLen:])),
+	}
+	dst := &net.TCPAddr{
+		IP:   net.IP(payload[ipLen : 2*ipLen]),
+		Port: int(binary.BigEndian.Uint16(payload[2*ipLen+2:])),
+	}
+	return src, dst, nil
+}
+
+// WriteProxyHeader sends a PROXY protocol header of the given version
+// (1 or 2) announcing a connection from src to dst.
+func WriteProxyHeader(w io.Writer, version int, src, dst net.Addr) error {
+	srcAddr, srcOK := src.(*net.TCPAddr)
+	dstAddr, dstOK := dst.(*net.TCPAddr)
+
+	if version == 1 {
+		if !srcOK || !dstOK {
+			_, err := io.WriteString(w, "PROXY UNKNOWN\r\n")
+			return err
+		}
+		family := "TCP4"
+		if srcAddr.IP.To4() == nil || dstAddr.IP.To4() == nil {
+			family = "TCP6"
+		}
+		_, err := fmt.Fprintf(w, "PROXY %s %s %s %d %d\r\n",
+			family, srcAddr.IP, dstAddr.IP, srcAddr.Port, dstAddr.Port)
+		return err
+	}
+
+	header := append([]byte{}, proxyV2Signature...)
+	if !srcOK || !dstOK {
+		// LOCAL command, no address block
+		_, err := w.Write(append(header, 0x20, 0x00, 0x00, 0x00))
+		return err
+	}
+
+	srcIP, dstIP := srcAddr.IP.To4(), dstAddr.IP.To4()
+	family := byte(0x11) // AF_INET, STREAM
+	if srcIP == nil || dstIP == nil {
+		srcIP, dstIP = srcAddr.IP.To16(), dstAddr.IP.To16()
+		family = 0x21 // AF_INET6, STREAM
+	}
+
+	payload := append(append([]byte{}, srcIP...), dstIP...)
+	payload = binary.BigEndian.AppendUint16(payload, uint16(srcAddr.Port))
+	payload = binary.BigEndian.AppendUint16(payload, uint16(dstAddr.Port))
+
+	header = append(header, 0x21, family)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(payload)))
+	_, err := w.Write(append(header, payload...))
+	return err
+}
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxyHeaderRoundTrip(t *testing.T) {
+	cases := []struct {
+		src, dst *net.TCPAddr
+	}{
+		{&net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 51234}, &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 443}},
+		{&net.TCPAddr{IP: net.ParseIP("2001:db8::7"), Port: 51234}, &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 80}},
+	}
+
+	for _, version := range []int{1, 2} {
+		for _, c := range cases {
+			var buf bytes.Buffer
+			assert.NoError(t, WriteProxyHeader(&buf, version, c.src, c.dst))
+			buf.WriteString("GET / HTTP/1.1\r\n")
+
+			r := bufio.NewReader(&buf)
+			src, dst, err := readProxyHeader(r)
+			assert.NoError(t, err)
+			assert.Equal(t, c.src.String(), src.String())
+			assert.Equal(t, c.dst.String(), dst.String())
+
+			rest, _ := io.ReadAll(r)
+			assert.Equal(t, "GET / HTTP/1.1\r\n", string(rest))
+		}
+	}
+}
+
+func TestProxyHeaderRejectsGarbage(t *testing.T) {
+	_, _, err := readProxyHeader(bufio.NewReader(strings.NewReader("POST / HTTP/1.1\r\n")))
+	assert.Error(t, err)
+
+	src, dst, err := readProxyHeader(bufio.NewReader(strings.NewReader("PROXY UNKNOWN\r\n")))
+	assert.NoError(t, err)
+	assert.Nil(t, src)
+	assert.Nil(t, dst)
+}
+
+func TestProxyProtocolListenerTrustedOnly(t *testing.T) {
+	trusted, err := ParseCIDRs("127.0.0.0/8, ::1/128")
+	assert.NoError(t, err)
+
+	raw, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	ln := NewProxyProtocolListener(raw, trusted)
+	defer ln.Close()
+
+	go func() {
+		conn, err := net.Dial("tcp", raw.Addr().String())
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("PROXY TCP4 198.51.100.9 10.0.0.1 40000 443\r\nhello"))
+	}()
+
+	conn, err := ln.Accept()
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	assert.Equal(t, "198.51.100.9:40000", conn.RemoteAddr().String())
+	payload, _ := io.ReadAll(conn)
+	assert.Equal(t, "hello", string(payload))
+
+	untrusted := NewProxyProtocolListener(raw, nil)
+	go func() {
+		conn, err := net.Dial("tcp", raw.Addr().String())
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("PROXY TCP4 198.51.100.9 10.0.0.1 40000 443\r\n"))
+	}()
+
+	conn, err = untrusted.Accept()
+	assert.NoError(t, err)
+	defer conn.Close()
+	assert.True(t, strings.HasPrefix(conn.RemoteAddr().String(), "127.0.0.1:"))
+}
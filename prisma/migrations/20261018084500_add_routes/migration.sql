@@ -0,0 +1,26 @@
+-- AlterTable
+ALTER TABLE "backends" ADD COLUMN     "route_id" TEXT;
+
+-- AlterTable
+ALTER TABLE "headers" ADD COLUMN     "route_id" TEXT;
+
+-- CreateTable
+CREATE TABLE "routes" (
+    "id" TEXT NOT NULL,
+    "created_at" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "host_id" TEXT NOT NULL,
+    "path" TEXT NOT NULL,
+    "exact" BOOLEAN NOT NULL DEFAULT false,
+
+    CONSTRAINT "routes_pkey" PRIMARY KEY ("id")
+);
+
+-- AddForeignKey
+ALTER TABLE "backends" ADD CONSTRAINT "backends_route_id_fkey" FOREIGN KEY ("route_id") REFERENCES "routes"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+
+-- AddForeignKey
+ALTER TABLE "headers" ADD CONSTRAINT "headers_route_id_fkey" FOREIGN KEY ("route_id") REFERENCES "routes"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+
+-- AddForeignKey
+ALTER TABLE "routes" ADD CONSTRAINT "routes_host_id_fkey" FOREIGN KEY ("host_id") REFERENCES "hosts"("id") ON DELETE CASCADE ON UPDATE CASCADE;
@@ -0,0 +1,2 @@
+-- CreateIndex
+CREATE INDEX "hosts_host_idx" ON "hosts"("host");
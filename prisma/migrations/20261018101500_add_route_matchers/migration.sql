@@ -0,0 +1,20 @@
+-- AlterTable
+ALTER TABLE "routes" ADD COLUMN     "methods" TEXT NOT NULL DEFAULT '',
+ADD COLUMN     "priority" INTEGER NOT NULL DEFAULT 0;
+
+-- CreateTable
+CREATE TABLE "route_matchers" (
+    "id" TEXT NOT NULL,
+    "created_at" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "route_id" TEXT NOT NULL,
+    "type" TEXT NOT NULL,
+    "name" TEXT NOT NULL,
+    "value" TEXT NOT NULL DEFAULT '',
+    "regex" BOOLEAN NOT NULL DEFAULT false,
+
+    CONSTRAINT "route_matchers_pkey" PRIMARY KEY ("id")
+);
+
+-- AddForeignKey
+ALTER TABLE "route_matchers" ADD CONSTRAINT "route_matchers_route_id_fkey" FOREIGN KEY ("route_id") REFERENCES "routes"("id") ON DELETE CASCADE ON UPDATE CASCADE;
@@ -0,0 +1,5 @@
+-- AlterTable
+ALTER TABLE "routes" ADD COLUMN     "add_prefix" TEXT NOT NULL DEFAULT '',
+ADD COLUMN     "rewrite_regex" TEXT NOT NULL DEFAULT '',
+ADD COLUMN     "rewrite_replacement" TEXT NOT NULL DEFAULT '',
+ADD COLUMN     "strip_prefix" TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+-- AlterTable
+ALTER TABLE "proxies" ADD COLUMN     "host_header_mode" TEXT NOT NULL DEFAULT 'preserve',
+ADD COLUMN     "host_header_value" TEXT NOT NULL DEFAULT '';
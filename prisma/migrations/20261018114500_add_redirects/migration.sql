@@ -0,0 +1,9 @@
+-- AlterTable
+ALTER TABLE "hosts" ADD COLUMN     "redirect_preserve_query" BOOLEAN NOT NULL DEFAULT true,
+ADD COLUMN     "redirect_status" INTEGER NOT NULL DEFAULT 302,
+ADD COLUMN     "redirect_url" TEXT NOT NULL DEFAULT '';
+
+-- AlterTable
+ALTER TABLE "routes" ADD COLUMN     "redirect_preserve_query" BOOLEAN NOT NULL DEFAULT true,
+ADD COLUMN     "redirect_status" INTEGER NOT NULL DEFAULT 302,
+ADD COLUMN     "redirect_url" TEXT NOT NULL DEFAULT '';
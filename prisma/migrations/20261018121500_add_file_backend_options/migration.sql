@@ -0,0 +1,3 @@
+-- AlterTable
+ALTER TABLE "backends" ADD COLUMN     "index_files" TEXT NOT NULL DEFAULT 'index.html',
+ADD COLUMN     "spa_fallback" BOOLEAN NOT NULL DEFAULT false;
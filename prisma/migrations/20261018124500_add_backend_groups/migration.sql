@@ -0,0 +1,23 @@
+-- AlterTable
+ALTER TABLE "backends" ADD COLUMN     "group_id" TEXT;
+
+-- AlterTable
+ALTER TABLE "proxies" ADD COLUMN     "group_cookie" TEXT NOT NULL DEFAULT '';
+
+-- CreateTable
+CREATE TABLE "backend_groups" (
+    "id" TEXT NOT NULL,
+    "created_at" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "name" TEXT NOT NULL,
+    "weight" INTEGER NOT NULL DEFAULT 0,
+    "proxy_id" TEXT,
+
+    CONSTRAINT "backend_groups_pkey" PRIMARY KEY ("id")
+);
+
+-- AddForeignKey
+ALTER TABLE "backends" ADD CONSTRAINT "backends_group_id_fkey" FOREIGN KEY ("group_id") REFERENCES "backend_groups"("id") ON DELETE SET NULL ON UPDATE CASCADE;
+
+-- AddForeignKey
+ALTER TABLE "backend_groups" ADD CONSTRAINT "backend_groups_proxy_id_fkey" FOREIGN KEY ("proxy_id") REFERENCES "proxies"("id") ON DELETE CASCADE ON UPDATE CASCADE;
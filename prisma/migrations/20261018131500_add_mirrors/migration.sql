@@ -0,0 +1,20 @@
+-- AlterTable
+ALTER TABLE "proxies" ADD COLUMN     "mirror_body_limit" INTEGER NOT NULL DEFAULT 1048576;
+
+-- CreateTable
+CREATE TABLE "mirrors" (
+    "id" TEXT NOT NULL,
+    "created_at" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "scheme" TEXT NOT NULL,
+    "host" TEXT NOT NULL,
+    "port" INTEGER,
+    "sample_percent" INTEGER NOT NULL DEFAULT 100,
+    "enabled" BOOLEAN NOT NULL DEFAULT true,
+    "proxy_id" TEXT,
+
+    CONSTRAINT "mirrors_pkey" PRIMARY KEY ("id")
+);
+
+-- AddForeignKey
+ALTER TABLE "mirrors" ADD CONSTRAINT "mirrors_proxy_id_fkey" FOREIGN KEY ("proxy_id") REFERENCES "proxies"("id") ON DELETE CASCADE ON UPDATE CASCADE;
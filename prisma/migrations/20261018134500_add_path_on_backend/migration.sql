@@ -0,0 +1,3 @@
+-- AlterTable
+ALTER TABLE "backends" ADD COLUMN     "path" TEXT NOT NULL DEFAULT '',
+ADD COLUMN     "query" TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+-- AlterTable
+ALTER TABLE "proxies" ADD COLUMN     "listen_port" INTEGER;
+
+-- CreateIndex
+CREATE UNIQUE INDEX "proxies_listen_port_key" ON "proxies"("listen_port");
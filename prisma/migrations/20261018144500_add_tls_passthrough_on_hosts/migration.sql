@@ -0,0 +1,2 @@
+-- AlterTable
+ALTER TABLE "hosts" ADD COLUMN     "tls_passthrough" BOOLEAN NOT NULL DEFAULT false;
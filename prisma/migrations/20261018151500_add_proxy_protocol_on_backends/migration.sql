@@ -0,0 +1,2 @@
+-- AlterTable
+ALTER TABLE "backends" ADD COLUMN     "proxy_protocol" INTEGER NOT NULL DEFAULT 0;
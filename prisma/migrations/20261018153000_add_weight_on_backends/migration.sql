@@ -0,0 +1,2 @@
+-- AlterTable
+ALTER TABLE "backends" ADD COLUMN     "weight" INTEGER NOT NULL DEFAULT 1;
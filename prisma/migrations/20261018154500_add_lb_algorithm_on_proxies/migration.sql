@@ -0,0 +1,2 @@
+-- AlterTable
+ALTER TABLE "proxies" ADD COLUMN     "lb_algorithm" TEXT NOT NULL DEFAULT 'round_robin';
@@ -0,0 +1,3 @@
+-- AlterTable
+ALTER TABLE "proxies" ADD COLUMN     "hash_key" TEXT NOT NULL DEFAULT 'ip',
+ADD COLUMN     "hash_key_name" TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,8 @@
+-- AlterTable
+ALTER TABLE "proxies" ADD COLUMN     "affinity_cookie" TEXT NOT NULL DEFAULT '',
+ADD COLUMN     "affinity_cookie_domain" TEXT NOT NULL DEFAULT '',
+ADD COLUMN     "affinity_cookie_http_only" BOOLEAN NOT NULL DEFAULT true,
+ADD COLUMN     "affinity_cookie_path" TEXT NOT NULL DEFAULT '/',
+ADD COLUMN     "affinity_cookie_same_site" TEXT NOT NULL DEFAULT 'lax',
+ADD COLUMN     "affinity_cookie_secure" BOOLEAN NOT NULL DEFAULT false,
+ADD COLUMN     "affinity_cookie_ttl" INTEGER NOT NULL DEFAULT 0;
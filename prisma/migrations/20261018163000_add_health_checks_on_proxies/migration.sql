@@ -0,0 +1,8 @@
+-- AlterTable
+ALTER TABLE "proxies" ADD COLUMN     "health_check_healthy_threshold" INTEGER NOT NULL DEFAULT 2,
+ADD COLUMN     "health_check_interval" INTEGER NOT NULL DEFAULT 10,
+ADD COLUMN     "health_check_path" TEXT NOT NULL DEFAULT '',
+ADD COLUMN     "health_check_status_max" INTEGER NOT NULL DEFAULT 399,
+ADD COLUMN     "health_check_status_min" INTEGER NOT NULL DEFAULT 200,
+ADD COLUMN     "health_check_timeout" INTEGER NOT NULL DEFAULT 2,
+ADD COLUMN     "health_check_unhealthy_threshold" INTEGER NOT NULL DEFAULT 3;
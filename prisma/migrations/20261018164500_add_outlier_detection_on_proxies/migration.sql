@@ -0,0 +1,5 @@
+-- AlterTable
+ALTER TABLE "proxies" ADD COLUMN     "outlier_base_ejection" INTEGER NOT NULL DEFAULT 30,
+ADD COLUMN     "outlier_consecutive_failures" INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN     "outlier_max_ejection" INTEGER NOT NULL DEFAULT 300,
+ADD COLUMN     "outlier_max_ejection_percent" INTEGER NOT NULL DEFAULT 50;
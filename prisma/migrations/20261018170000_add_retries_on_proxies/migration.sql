@@ -0,0 +1,5 @@
+-- AlterTable
+ALTER TABLE "proxies" ADD COLUMN     "retry_attempts" INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN     "retry_budget_percent" INTEGER NOT NULL DEFAULT 20,
+ADD COLUMN     "retry_non_idempotent" BOOLEAN NOT NULL DEFAULT false,
+ADD COLUMN     "retry_per_try_timeout_ms" INTEGER NOT NULL DEFAULT 0;
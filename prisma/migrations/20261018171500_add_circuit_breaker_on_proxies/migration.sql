@@ -0,0 +1,9 @@
+-- AlterTable
+ALTER TABLE "proxies" ADD COLUMN     "breaker_error_percent" INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN     "breaker_half_open_requests" INTEGER NOT NULL DEFAULT 3,
+ADD COLUMN     "breaker_latency_ms" INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN     "breaker_min_requests" INTEGER NOT NULL DEFAULT 20,
+ADD COLUMN     "breaker_open_duration" INTEGER NOT NULL DEFAULT 30,
+ADD COLUMN     "breaker_retry_after" INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN     "breaker_status" INTEGER NOT NULL DEFAULT 503,
+ADD COLUMN     "breaker_window" INTEGER NOT NULL DEFAULT 10;
@@ -0,0 +1,5 @@
+-- Backfill
+UPDATE "backends" SET "weight" = 1 WHERE "weight" < 1;
+
+-- AddCheckConstraint, not managed by Prisma
+ALTER TABLE "backends" ADD CONSTRAINT "backends_weight_check" CHECK ("weight" >= 1);